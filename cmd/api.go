@@ -0,0 +1,334 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+)
+
+// apiChange is a change of the exported API.
+type apiChange struct {
+	compatible bool
+	desc       string
+}
+
+type apiChanges []apiChange
+
+func (cs *apiChanges) add(compatible bool, format string, args ...interface{}) {
+	*cs = append(*cs, apiChange{compatible: compatible, desc: fmt.Sprintf(format, args...)})
+}
+
+// apiDecl is an exported global declaration.
+type apiDecl struct {
+	kind string // "type", "func", "method", "var" or "const"
+	name string // e.g. "Server.Start" for methods
+
+	typ  *ast.TypeSpec
+	fn   *ast.FuncDecl
+	val  ast.Expr // type of a var, nil if not specified
+	id   *ast.Ident
+	cnst *constDef
+}
+
+func (d *apiDecl) String() string {
+	return d.kind + " " + d.name
+}
+
+// recvTypeName returns the name of the receiver base type of a method, and
+// whether it is a pointer receiver.
+func recvTypeName(d *ast.FuncDecl) (name string, pointer bool) {
+	tp := d.Recv.List[0].Type
+	if st, ok := tp.(*ast.StarExpr); ok {
+		tp, pointer = st.X, true
+	} // if
+	switch t := tp.(type) {
+	case *ast.IndexExpr:
+		tp = t.X
+	case *ast.IndexListExpr:
+		tp = t.X
+	}
+	if id, ok := tp.(*ast.Ident); ok {
+		return id.Name, pointer
+	} // if
+	return "", pointer
+}
+
+// collectAPI returns the exported declarations in the order of fragments.
+func collectAPI(info *fileInfo) (decls []*apiDecl) {
+	for _, p := range info.types.Parts {
+		if ts, ok := p.(*fragment).node.(*ast.TypeSpec); ok && ts.Name.IsExported() {
+			decls = append(decls, &apiDecl{kind: "type", name: ts.Name.Name, typ: ts})
+		} // if
+	} // for p
+
+	for _, p := range info.vars.Parts {
+		switch nd := p.(*fragment).node.(type) {
+		case *ast.ValueSpec:
+			for _, name := range nd.Names {
+				if name.IsExported() {
+					decls = append(decls, &apiDecl{kind: "var", name: name.Name, val: nd.Type, id: name})
+				} // if
+			} // for name
+		case *ast.GenDecl:
+			for _, cd := range info.consts.byDecl[nd] {
+				if ast.IsExported(cd.name) {
+					decls = append(decls, &apiDecl{kind: "const", name: cd.name, cnst: cd})
+				} // if
+			} // for cd
+		}
+	} // for p
+
+	for _, p := range info.funcs.Parts {
+		fd, ok := p.(*fragment).node.(*ast.FuncDecl)
+		if !ok || !fd.Name.IsExported() {
+			continue
+		} // if
+		if fd.Recv == nil || len(fd.Recv.List) == 0 {
+			decls = append(decls, &apiDecl{kind: "func", name: fd.Name.Name, fn: fd})
+			continue
+		} // if
+		if recv, _ := recvTypeName(fd); ast.IsExported(recv) {
+			decls = append(decls, &apiDecl{kind: "method", name: recv + "." + fd.Name.Name, fn: fd})
+		} // if
+	} // for p
+
+	return decls
+}
+
+func typesString(tps []ast.Expr) string {
+	s := ""
+	for _, tp := range tps {
+		s = cat(s, ", ", exprString(tp))
+	} // for tp
+	return "(" + s + ")"
+}
+
+// diffFieldTypes compares the parameters or the results of two functions.
+func diffFieldTypes(cs *apiChanges, what, kind string, orgFl, newFl *ast.FieldList) {
+	orgTps, newTps := fieldTypes(orgFl), fieldTypes(newFl)
+	if len(orgTps) != len(newTps) {
+		cs.add(false, "%s: %ss changed from %s to %s", what, kind, typesString(orgTps), typesString(newTps))
+		return
+	} // if
+	for i := range orgTps {
+		if o, n := exprString(orgTps[i]), exprString(newTps[i]); o != n {
+			cs.add(false, "%s: %s %d type changed from %s to %s", what, kind, i+1, o, n)
+		} // if
+	} // for i
+}
+
+func diffFuncAPI(cs *apiChanges, what string, orgT, newT *ast.FuncType) {
+	diffFieldTypes(cs, what, "parameter", orgT.Params, newT.Params)
+	diffFieldTypes(cs, what, "result", orgT.Results, newT.Results)
+}
+
+// embeddedName returns the field name of an embedded type.
+func embeddedName(tp ast.Expr) string {
+	switch t := tp.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return exprString(tp)
+}
+
+// exportedFields returns the exported fields, or methods of an interface, by
+// their names. Embedded fields are keyed by the type name. unexported is set
+// if any field is unexported.
+func exportedFields(fl *ast.FieldList) (names []string, fields map[string]ast.Expr, unexported bool) {
+	fields = make(map[string]ast.Expr)
+	for _, f := range fl.List {
+		if len(f.Names) == 0 {
+			name := embeddedName(f.Type)
+			if !ast.IsExported(name) {
+				unexported = true
+				continue
+			} // if
+			names, fields[name] = append(names, name), f.Type
+			continue
+		} // if
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				unexported = true
+				continue
+			} // if
+			names, fields[name.Name] = append(names, name.Name), f.Type
+		} // for name
+	} // for f
+	return names, fields, unexported
+}
+
+func diffTypeAPI(cs *apiChanges, name string, orgTs, newTs *ast.TypeSpec) {
+	if (orgTs.Assign > 0) != (newTs.Assign > 0) {
+		cs.add(false, "type %s: changed between alias and defined type", name)
+		return
+	} // if
+
+	switch ot := orgTs.Type.(type) {
+	case *ast.StructType:
+		nt, ok := newTs.Type.(*ast.StructType)
+		if !ok {
+			break
+		} // if
+		orgNames, orgFields, _ := exportedFields(ot.Fields)
+		newNames, newFields, _ := exportedFields(nt.Fields)
+		for _, fn := range orgNames {
+			if nf, ok := newFields[fn]; !ok {
+				cs.add(false, "type %s: field %s removed", name, fn)
+			} else if o, n := exprString(orgFields[fn]), exprString(nf); o != n {
+				cs.add(false, "type %s: field %s type changed from %s to %s", name, fn, o, n)
+			} // else if
+		} // for fn
+		for _, fn := range newNames {
+			if _, ok := orgFields[fn]; !ok {
+				cs.add(true, "type %s: field %s added", name, fn)
+			} // if
+		} // for fn
+		return
+
+	case *ast.InterfaceType:
+		nt, ok := newTs.Type.(*ast.InterfaceType)
+		if !ok {
+			break
+		} // if
+		orgNames, orgMethods, sealed := exportedFields(ot.Methods)
+		newNames, newMethods, _ := exportedFields(nt.Methods)
+		for _, mn := range orgNames {
+			nm, ok := newMethods[mn]
+			if !ok {
+				cs.add(false, "type %s: interface method %s removed", name, mn)
+				continue
+			} // if
+			if ft, ok := orgMethods[mn].(*ast.FuncType); ok {
+				if nft, ok := nm.(*ast.FuncType); ok {
+					diffFuncAPI(cs, "type "+name+": interface method "+mn, ft, nft)
+					continue
+				} // if
+			} // if
+			if o, n := exprString(orgMethods[mn]), exprString(nm); o != n {
+				cs.add(false, "type %s: embedded interface %s changed to %s", name, o, n)
+			} // if
+		} // for mn
+		for _, mn := range newNames {
+			if _, ok := orgMethods[mn]; !ok {
+				// Interfaces with unexported methods cannot be implemented
+				// outside the package.
+				cs.add(sealed, "type %s: interface method %s added", name, mn)
+			} // if
+		} // for mn
+		return
+	}
+
+	if o, n := exprString(orgTs.Type), exprString(newTs.Type); o != n {
+		cs.add(false, "type %s: definition changed from %s to %s", name, o, n)
+	} // if
+}
+
+func diffDeclAPI(cs *apiChanges, orgInfo *fileInfo, od *apiDecl, newInfo *fileInfo, nd *apiDecl) {
+	switch od.kind {
+	case "type":
+		diffTypeAPI(cs, od.name, od.typ, nd.typ)
+
+	case "func", "method":
+		what := od.String()
+		if od.kind == "method" {
+			_, orgPtr := recvTypeName(od.fn)
+			_, newPtr := recvTypeName(nd.fn)
+			if !orgPtr && newPtr {
+				cs.add(false, "%s: receiver changed to a pointer", what)
+			} // if
+		} // if
+		diffFuncAPI(cs, what, od.fn.Type, nd.fn.Type)
+
+	case "var":
+		if od.val != nil && nd.val != nil {
+			if o, n := exprString(od.val), exprString(nd.val); o != n {
+				cs.add(false, "var %s: type changed from %s to %s", od.name, o, n)
+			} // if
+			break
+		} // if
+		// The type is inferred, resolve it if type-checked.
+		orgT, newT := defType(orgInfo, od.id), defType(newInfo, nd.id)
+		if orgT != nil && newT != nil && qualifiedTypeString(orgT) != qualifiedTypeString(newT) {
+			cs.add(false, "var %s: type changed from %s to %s", od.name,
+				resolvedTypeString(orgT), resolvedTypeString(newT))
+		} // if
+
+	case "const":
+		oc, nc := od.cnst, nd.cnst
+		o, n := "untyped", "untyped"
+		if oc.tp != nil {
+			o = exprString(oc.tp)
+		} // if
+		if nc.tp != nil {
+			n = exprString(nc.tp)
+		} // if
+		if o != n {
+			cs.add(false, "const %s: type changed from %s to %s", od.name, o, n)
+		} // if
+		if oc.value.Kind() != constant.Unknown && nc.value.Kind() != constant.Unknown &&
+			(oc.value.Kind() != nc.value.Kind() || !constant.Compare(oc.value, token.EQL, nc.value)) {
+			cs.add(true, "const %s: value changed from %s to %s", od.name,
+				constValueString(oc.value), constValueString(nc.value))
+		} // if
+	}
+}
+
+// compareAPI classifies the changes of exported declarations.
+func compareAPI(orgInfo, newInfo *fileInfo) (cs apiChanges) {
+	orgDecls, newDecls := collectAPI(orgInfo), collectAPI(newInfo)
+	newByName := make(map[string]*apiDecl)
+	for _, d := range newDecls {
+		newByName[d.String()] = d
+	} // for d
+	orgByName := make(map[string]*apiDecl)
+	for _, d := range orgDecls {
+		orgByName[d.String()] = d
+	} // for d
+
+	for _, od := range orgDecls {
+		nd, ok := newByName[od.String()]
+		if !ok {
+			cs.add(false, "%s removed", od)
+			continue
+		} // if
+		diffDeclAPI(&cs, orgInfo, od, newInfo, nd)
+	} // for od
+	for _, nd := range newDecls {
+		if _, ok := orgByName[nd.String()]; !ok {
+			cs.add(true, "%s added", nd)
+		} // if
+	} // for nd
+
+	return cs
+}
+
+// semverBump returns the suggested part of the semantic version to bump.
+func semverBump(cs apiChanges) string {
+	bump := "patch"
+	for _, c := range cs {
+		if !c.compatible {
+			return "major"
+		} // if
+		bump = "minor"
+	} // for c
+	return bump
+}
+
+// diffAPI shows the changes of exported declarations, whether they break
+// callers, and the suggested semantic version bump.
+func diffAPI(orgInfo, newInfo *fileInfo) {
+	cs := compareAPI(orgInfo, newInfo)
+	for _, c := range cs {
+		if c.compatible {
+			showInsLine("compatible: " + c.desc)
+		} else {
+			showDelLine("incompatible: " + c.desc)
+		} // else
+	} // for c
+	fmt.Fprintln(gOut, "suggested version bump:", semverBump(cs))
+}
@@ -0,0 +1,88 @@
+package godiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestDiffAPI(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+
+	orgInfo, err := parse("", `
+package lib
+
+type Server struct {
+	Addr string
+	Port int
+	mu   sync.Mutex
+}
+
+type Handler interface {
+	Serve(req string) error
+}
+
+const Version = "1.0"
+
+func (s Server) Start(timeout int) error { return nil }
+
+func (s *Server) Stop() {}
+
+func Helper() {}
+
+func internal() {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package lib
+
+type Server struct {
+	Addr string
+	Port int64
+	Name string
+}
+
+type Handler interface {
+	Serve(req string) error
+	Close()
+}
+
+const Version = "1.1"
+
+func (s *Server) Start(timeout time.Duration) error { return nil }
+
+func (s *Server) Stop() {}
+
+func NewServer() *Server { return nil }
+
+func internal(a int) {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffAPI(orgInfo, newInfo)
+
+	assert.StringEqual(t, "api", strings.Split(string(buf), "\n"), strings.Split(
+		`--- incompatible: type Server: field Port type changed from int to int64
++++ compatible: type Server: field Name added
+--- incompatible: type Handler: interface method Close added
++++ compatible: const Version: value changed from "1.0" to "1.1"
+--- incompatible: method Server.Start: receiver changed to a pointer
+--- incompatible: method Server.Start: parameter 1 type changed from int to time.Duration
+--- incompatible: func Helper removed
++++ compatible: func NewServer added
+suggested version bump: major
+`, "\n"))
+}
+
+func TestSemverBump(t *testing.T) {
+	assert.Equal(t, "no changes", semverBump(nil), "patch")
+	assert.Equal(t, "compatible", semverBump(apiChanges{{compatible: true}}), "minor")
+	assert.Equal(t, "incompatible", semverBump(apiChanges{{compatible: true}, {}}), "major")
+}
@@ -0,0 +1,116 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+
+	"github.com/daviddengcn/go-villa"
+)
+
+// callGraph maps the symbol of a function to the symbols of the functions in
+// the same file it calls. Calls are resolved syntactically: a selector call
+// x.M() is an edge to every method named M.
+type callGraph map[string]villa.StrSet
+
+func buildCallGraph(info *fileInfo) callGraph {
+	// funcs maps a function name, or a method name prefixed with ".", to
+	// symbols.
+	funcs := make(map[string][]string)
+	for _, p := range info.funcs.Parts {
+		fd, ok := p.(*fragment).node.(*ast.FuncDecl)
+		if !ok {
+			continue
+		} // if
+		key := fd.Name.Name
+		if fd.Recv != nil {
+			key = "." + key
+		} // if
+		funcs[key] = append(funcs[key], funcSymbol(fd))
+	} // for p
+
+	imports := importNames(info.f)
+	g := make(callGraph)
+	for _, p := range info.funcs.Parts {
+		fd, ok := p.(*fragment).node.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		} // if
+		callees := villa.NewStrSet()
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			} // if
+			switch fn := call.Fun.(type) {
+			case *ast.Ident:
+				callees.Put(funcs[fn.Name]...)
+			case *ast.SelectorExpr:
+				if id, ok := fn.X.(*ast.Ident); !ok || !imports.In(id.Name) {
+					callees.Put(funcs["."+fn.Sel.Name]...)
+				} // if
+			}
+			return true
+		})
+		g[funcSymbol(fd)] = callees
+	} // for p
+	return g
+}
+
+// callersOf returns the sorted symbols of the functions calling sym.
+func (g callGraph) callersOf(sym string) (callers []string) {
+	for caller, callees := range g {
+		if callees.In(sym) {
+			callers = append(callers, caller)
+		} // if
+	} // for caller, callees
+	sort.Strings(callers)
+	return callers
+}
+
+// diffStrSet returns the sorted elements of a which are not in b.
+func diffStrSet(a, b villa.StrSet) (res []string) {
+	for el := range a {
+		if !b.In(el) {
+			res = append(res, el)
+		} // if
+	} // for el
+	sort.Strings(res)
+	return res
+}
+
+// annotateDeletedCalls shows the callers of a deleted function in the org
+// version.
+func annotateDeletedCalls(orgInfo *fileInfo, orgF diffFragment) {
+	fd, ok := orgF.(*fragment).node.(*ast.FuncDecl)
+	if !ok {
+		return
+	} // if
+	if callers := orgInfo.calls.callersOf(funcSymbol(fd)); len(callers) > 0 {
+		showNoteLine("was called by " + strings.Join(callers, ", "))
+	} // if
+}
+
+// annotateCalls shows the callers of a changed function and the call edges
+// from it that are introduced or removed.
+func annotateCalls(orgInfo *fileInfo, orgF diffFragment, newInfo *fileInfo, newF diffFragment) {
+	orgFd, ok1 := orgF.(*fragment).node.(*ast.FuncDecl)
+	newFd, ok2 := newF.(*fragment).node.(*ast.FuncDecl)
+	if !ok1 || !ok2 {
+		return
+	} // if
+	orgSym, newSym := funcSymbol(orgFd), funcSymbol(newFd)
+
+	if callers := newInfo.calls.callersOf(newSym); len(callers) > 0 {
+		showNoteLine("called by " + strings.Join(callers, ", "))
+	} // if
+
+	orgCallees, newCallees := orgInfo.calls[orgSym], newInfo.calls[newSym]
+	for _, callee := range diffStrSet(newCallees, orgCallees) {
+		showNoteLine(fmt.Sprintf("new call to %s", callee))
+	} // for callee
+	for _, callee := range diffStrSet(orgCallees, newCallees) {
+		showNoteLine(fmt.Sprintf("removed call to %s", callee))
+	} // for callee
+}
@@ -0,0 +1,103 @@
+package godiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestBuildCallGraph(t *testing.T) {
+	info, err := parse("", symbolsOrg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	g := buildCallGraph(info)
+	assert.StringEqual(t, "Server.Start", diffStrSet(g["Server.Start"], nil), "[Server.listen]")
+	assert.StringEqual(t, "Server.listen", diffStrSet(g["Server.listen"], nil), "[]")
+	assert.StringEqual(t, "Run", diffStrSet(g["Run"], nil), "[Server.Start]")
+	assert.StringEqual(t, "callers of Run", g.callersOf("Run"), "[TestRun]")
+}
+
+func TestDiff_CallGraph(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{CallGraph: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func a() { b() }
+
+func b() {}
+
+func c() {}
+
+func main() { a() }
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func a() { c() }
+
+func b() {}
+
+func c() {}
+
+func main() { a() }
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffFuncs(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", strings.Split(string(buf), "\n"), strings.Split(
+		`    func a() {
+---     b()
++++     c()
+    }
+::: called by main
+::: new call to c
+::: removed call to b
+`, "\n"))
+}
+
+func TestDiff_CallGraphDeleted(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{CallGraph: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func a() { b() }
+
+func b() {}
+
+func main() { a(); b() }
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func a() {}
+
+func main() { a() }
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffFuncs(orgInfo, newInfo)
+
+	assert.Equal(t, "deleted b", strings.Contains(string(buf), "=== func b() { ... } (2 lines)\n::: was called by a, main\n"), true)
+}
@@ -0,0 +1,180 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+func appendUnique(list []string, els ...string) []string {
+	for _, el := range els {
+		found := false
+		for _, s := range list {
+			if s == el {
+				found = true
+				break
+			} // if
+		} // for s
+		if !found {
+			list = append(list, el)
+		} // if
+	} // for el
+	return list
+}
+
+// concurrencyTags returns the concurrency constructs found in a line of
+// source.
+func concurrencyTags(line string) (tags []string) {
+	s := strings.TrimSpace(line)
+	if strings.HasPrefix(s, "go ") {
+		tags = append(tags, "go statement")
+	} // if
+	if strings.HasPrefix(s, "select ") {
+		tags = append(tags, "select")
+	} // if
+	if hasChanOp(s) {
+		tags = append(tags, "channel operation")
+	} // if
+	if strings.HasPrefix(s, "defer ") {
+		tags = append(tags, "defer")
+	} // if
+	for _, m := range []string{".Lock()", ".Unlock()", ".RLock()", ".RUnlock()"} {
+		if strings.Contains(s, m) {
+			tags = append(tags, "lock")
+			break
+		} // if
+	} // for m
+	if hasSyncSelector(s) {
+		tags = append(tags, "sync")
+	} // if
+	return tags
+}
+
+// hasSyncSelector returns true if a line of source selects from package sync
+// or atomic, i.e. "sync" or "atomic" is an identifier followed by a period and
+// not itself selected, so that e.g. async.Foo or x.sync.Foo are not counted.
+func hasSyncSelector(line string) bool {
+	src := []byte(line)
+	fs := token.NewFileSet()
+	var sc scanner.Scanner
+	sc.Init(fs.AddFile("", -1, len(src)), src, nil, 0)
+
+	prev, pkg := token.ILLEGAL, false
+	for {
+		_, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			return false
+		} // if
+		if pkg && tok == token.PERIOD {
+			return true
+		} // if
+		pkg = tok == token.IDENT && (lit == "sync" || lit == "atomic") && prev != token.PERIOD
+		prev = tok
+	} // for
+}
+
+// hasChanOp returns true if a line of source sends to or receives from a
+// channel. The line is parsed as statements, completed if it opens a block or
+// is a case of a select, so that "<-" in strings and channel types is not
+// counted. Lines that can not be parsed have no channel operations.
+func hasChanOp(line string) (found bool) {
+	if !strings.Contains(line, "<-") {
+		return false
+	} // if
+	for _, body := range []string{line, line + "\n}", "select {\n" + line + "\n}"} {
+		f, err := parser.ParseFile(token.NewFileSet(), "", "package p\nfunc _() {\n"+body+"\n}\n", 0)
+		if err != nil {
+			continue
+		} // if
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch nd := n.(type) {
+			case *ast.SendStmt:
+				found = true
+			case *ast.UnaryExpr:
+				if nd.Op == token.ARROW {
+					found = true
+				} // if
+			}
+			return !found
+		})
+		return found
+	} // for body
+	return false
+}
+
+// lockKey is a locked expression and whether it is read-locked.
+type lockKey struct {
+	x    string
+	read bool
+}
+
+func (k lockKey) String() string {
+	if k.read {
+		return k.x + ".RLock()"
+	} // if
+	return k.x + ".Lock()"
+}
+
+// lockCounts returns, for each locked expression, the numbers of Lock and
+// Unlock calls (including deferred) in a function. Read locks are counted
+// separately.
+func lockCounts(fd *ast.FuncDecl) (locks, unlocks map[lockKey]int) {
+	locks, unlocks = make(map[lockKey]int), make(map[lockKey]int)
+	if fd.Body == nil {
+		return locks, unlocks
+	} // if
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) > 0 {
+			return true
+		} // if
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		} // if
+		x := exprString(sel.X)
+		switch sel.Sel.Name {
+		case "Lock":
+			locks[lockKey{x, false}]++
+		case "RLock":
+			locks[lockKey{x, true}]++
+		case "Unlock":
+			unlocks[lockKey{x, false}]++
+		case "RUnlock":
+			unlocks[lockKey{x, true}]++
+		}
+		return true
+	})
+	return locks, unlocks
+}
+
+// annotateLocks warns about lock calls, added in a changed or new function,
+// without matching unlock calls. orgF is nil for a new function.
+func annotateLocks(orgF, newF diffFragment) {
+	newFd, ok := newF.(*fragment).node.(*ast.FuncDecl)
+	if !ok {
+		return
+	} // if
+	orgLocks := make(map[lockKey]int)
+	if orgF != nil {
+		if orgFd, ok := orgF.(*fragment).node.(*ast.FuncDecl); ok {
+			orgLocks, _ = lockCounts(orgFd)
+		} // if
+	} // if
+	locks, unlocks := lockCounts(newFd)
+
+	var calls []string
+	for key, cnt := range locks {
+		if cnt > orgLocks[key] && cnt > unlocks[key] {
+			calls = append(calls, key.String())
+		} // if
+	} // for key, cnt
+	sort.Strings(calls)
+	for _, call := range calls {
+		showWarnLine(fmt.Sprintf("%s: %s added without matching unlock", funcSymbol(newFd), call))
+	} // for call
+}
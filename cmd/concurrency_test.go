@@ -0,0 +1,113 @@
+package godiff
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestConcurrencyTags(t *testing.T) {
+	assert.StringEqual(t, "go", concurrencyTags("go func() {"), []string{"go statement"})
+	assert.StringEqual(t, "send", concurrencyTags("ch <- v"), []string{"channel operation"})
+	assert.StringEqual(t, "receive", concurrencyTags("v, ok := <-ch"), []string{"channel operation"})
+	assert.StringEqual(t, "select case", concurrencyTags("case v := <-ch:"), []string{"channel operation"})
+	assert.StringEqual(t, "for range", concurrencyTags("for v := range <-chs {"), []string{"channel operation"})
+	assert.StringEqual(t, "string", concurrencyTags(`s := "a <- b"`), []string(nil))
+	assert.StringEqual(t, "chan type", concurrencyTags("var out chan<- int"), []string(nil))
+	assert.StringEqual(t, "recv chan type", concurrencyTags("func f(in <-chan int) {"), []string(nil))
+	assert.StringEqual(t, "defer", concurrencyTags("defer mu.Unlock()"), []string{"defer", "lock"})
+	assert.StringEqual(t, "sync", concurrencyTags("var wg sync.WaitGroup"), []string{"sync"})
+	assert.StringEqual(t, "atomic", concurrencyTags("atomic.AddInt64(&n, 1)"), []string{"sync"})
+	assert.StringEqual(t, "async", concurrencyTags("async.Foo()"), []string(nil))
+	assert.StringEqual(t, "field sync", concurrencyTags("x.sync.Foo()"), []string(nil))
+	assert.StringEqual(t, "sync in string", concurrencyTags(`s := "sync.Mutex"`), []string(nil))
+	assert.StringEqual(t, "plain", concurrencyTags("a := b + c"), []string(nil))
+}
+
+func TestDiff_Concurrency(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{Concurrency: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func (s *Server) Get(k string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m[k]
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func (s *Server) Get(k string) string {
+	s.mu.RLock()
+	v := s.m[k]
+	s.mu.Lock()
+	return v
+}
+
+func (s *Server) Put(k, v string) {
+	s.mu.Lock()
+	s.m[k] = v
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffFuncs(orgInfo, newInfo)
+
+	out := string(buf)
+	t.Logf("%s", out)
+	assert.Equal(t, "concurrency tags", strings.Contains(out, "concurrency: defer, lock"), true)
+	assert.Equal(t, "Get lock", strings.Contains(out, "Server.Get: s.mu.Lock() added without matching unlock"), true)
+	assert.Equal(t, "Get rlock", strings.Contains(out, "Server.Get: s.mu.RLock() added"), false)
+	assert.Equal(t, "Put lock", strings.Contains(out, "Server.Put: s.mu.Lock() added without matching unlock"), true)
+}
+
+func TestLockCounts(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", `package main
+
+func f() {
+	s.muR.Lock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+}
+`, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	locks, unlocks := lockCounts(f.Decls[0].(*ast.FuncDecl))
+	assert.Equal(t, "muR locks", locks[lockKey{"s.muR", false}], 1)
+	assert.Equal(t, "mu read locks", locks[lockKey{"s.mu", true}], 1)
+	assert.Equal(t, "mu read unlocks", unlocks[lockKey{"s.mu", true}], 1)
+	assert.Equal(t, "muR unlocks", unlocks[lockKey{"s.muR", false}], 0)
+}
+
+func TestDiffLines_ConcurrencyTags(t *testing.T) {
+	defer func() { gOut, gOptions = nil, Options{} }()
+
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{NoColor: true, Concurrency: true}
+	diffLines([]string{"a := 1", "b := 2", "c := 3"}, []string{"go f()", "ch <- 1", "b := 2", "c := 3"}, "%s")
+	// The tags are shown once, after the changed lines of the hunk.
+	assert.StringEqual(t, "out", string(buf), `+++ go f()
+--- a := 1
++++ ch <- 1
+!!! concurrency: go statement, channel operation
+    b := 2
+    c := 3
+`)
+}
@@ -0,0 +1,257 @@
+package godiff
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daviddengcn/go-villa"
+	"github.com/golangplus/fmt"
+)
+
+// configNames are the names of the config files, in the order of preference.
+var configNames = []string{".go-diff.toml", ".go-diff.json"}
+
+// firstConfig returns the first existing config file in dir, or "" if none.
+func firstConfig(dir villa.Path, names []string) string {
+	for _, name := range names {
+		if fn := dir.Join(name); fn.Exists() {
+			return fn.S()
+		} // if
+	} // for name
+	return ""
+}
+
+// FindConfigs returns the config files to apply, in order: the user config in
+// $XDG_CONFIG_HOME/go-diff, then the nearest config in dir or its ancestors, up
+// to the root of the repository containing dir. Later files override earlier
+// ones.
+func FindConfigs(dir string) (fns []string) {
+	cfgHome := os.Getenv("XDG_CONFIG_HOME")
+	if cfgHome == "" {
+		if home := os.Getenv("HOME"); home != "" {
+			cfgHome = villa.Path(home).Join(".config").S()
+		} // if
+	} // if
+	if cfgHome != "" {
+		if fn := firstConfig(villa.Path(cfgHome).Join("go-diff"), []string{"config.toml", "config.json"}); fn != "" {
+			fns = append(fns, fn)
+		} // if
+	} // if
+
+	for d := villa.Path(dir); ; {
+		if fn := firstConfig(d, configNames); fn != "" {
+			fns = append(fns, fn)
+			break
+		} // if
+		parent := d.Dir()
+		if d.Join(".git").Exists() || parent == d {
+			break
+		} // if
+		d = parent
+	} // for d
+	return fns
+}
+
+// ConfigDir returns the directory to search the config files from: that of
+// the first file in args, which may start with a subcommand, or "" if there
+// is none.
+func ConfigDir(args []string) string {
+	if len(args) > 1 {
+		switch args[0] {
+		case "merge", "diff3", "apply":
+			args = args[1:]
+		} // switch
+	} // if
+	if len(args) == 0 || args[0] == "-" {
+		return ""
+	} // if
+	fn, err := filepath.Abs(args[0])
+	if err != nil {
+		return ""
+	} // if
+	return filepath.Dir(fn)
+}
+
+// parseTOMLValue converts a TOML value into the string form of a flag.
+// Arrays of strings are joined with commas.
+func parseTOMLValue(v string) (string, error) {
+	if strings.HasPrefix(v, "[") {
+		if !strings.HasSuffix(v, "]") {
+			return "", fmt.Errorf("unterminated array %s", v)
+		} // if
+		var els []string
+		for _, el := range strings.Split(v[1:len(v)-1], ",") {
+			if el = strings.TrimSpace(el); el == "" {
+				continue
+			} // if
+			s, err := parseTOMLValue(el)
+			if err != nil {
+				return "", err
+			} // if
+			els = append(els, s)
+		} // for el
+		return strings.Join(els, ","), nil
+	} // if
+	if strings.HasPrefix(v, `"`) {
+		return strconv.Unquote(v)
+	} // if
+	if strings.HasPrefix(v, "'") {
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("unterminated string %s", v)
+		} // if
+		return v[1 : len(v)-1], nil
+	} // if
+	if v == "true" || v == "false" {
+		return v, nil
+	} // if
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		return "", fmt.Errorf("unsupported value %s", v)
+	} // if
+	return v, nil
+}
+
+// stripComment removes a trailing "#" comment outside of quoted strings from
+// a TOML value.
+func stripComment(v string) string {
+	var quote byte
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} // if
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return v[:i]
+		} // switch
+	} // for i
+	return v
+}
+
+// parseTOML parses the subset of TOML used by config files: top level
+// "key = value" lines with booleans, numbers, strings and arrays of strings.
+func parseTOML(src string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		} // if
+		p := strings.Index(line, "=")
+		if p < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		} // if
+		key, value := strings.TrimSpace(line[:p]), strings.TrimSpace(stripComment(line[p+1:]))
+		v, err := parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		} // if
+		settings[key] = v
+	} // for i, line
+	return settings, nil
+}
+
+// parseJSONConfig parses a JSON object of settings.
+func parseJSONConfig(src []byte) (map[string]string, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(src, &obj); err != nil {
+		return nil, err
+	} // if
+	settings := make(map[string]string)
+	for key, v := range obj {
+		switch vl := v.(type) {
+		case []interface{}:
+			var els []string
+			for _, el := range vl {
+				els = append(els, fmt.Sprint(el))
+			} // for el
+			settings[key] = strings.Join(els, ",")
+		default:
+			settings[key] = fmt.Sprint(vl)
+		}
+	} // for key, v
+	return settings, nil
+}
+
+// ReadConfig reads the settings of a config file, keyed by flag names. Files
+// with a .json extension are parsed as JSON, otherwise as TOML.
+func ReadConfig(fn string) (map[string]string, error) {
+	src, err := villa.Path(fn).ReadFile()
+	if err != nil {
+		return nil, err
+	} // if
+	var settings map[string]string
+	if villa.Path(fn).Ext() == ".json" {
+		settings, err = parseJSONConfig(src)
+	} else {
+		settings, err = parseTOML(string(src))
+	} // else
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	} // if
+	return settings, nil
+}
+
+// ApplyConfigs sets the flags in fs from the config files in order. Only the
+// flags named in keys may be set by a config. Flags already set in fs, i.e. on
+// the command line, are kept so that they override the configs.
+func ApplyConfigs(fs *flag.FlagSet, fns []string, keys ...string) error {
+	allowed := villa.NewStrSet(keys...)
+	explicit := villa.NewStrSet()
+	fs.Visit(func(f *flag.Flag) {
+		explicit.Put(f.Name)
+	})
+	for _, fn := range fns {
+		settings, err := ReadConfig(fn)
+		if err != nil {
+			return err
+		} // if
+		names := make([]string, 0, len(settings))
+		for key := range settings {
+			names = append(names, key)
+		} // for key
+		sort.Strings(names)
+		for _, key := range names {
+			if fs.Lookup(key) == nil || !allowed.In(key) {
+				return fmt.Errorf("%s: unknown setting %s", fn, key)
+			} // if
+			if explicit.In(key) {
+				continue
+			} // if
+			if err := fs.Set(key, settings[key]); err != nil {
+				return fmt.Errorf("%s: %s: %v", fn, key, err)
+			} // if
+		} // for key
+	} // for fn
+	return nil
+}
+
+// PrintConfig prints the effective settings of the flags in fs named in keys,
+// in the TOML config format.
+func PrintConfig(w io.Writer, fs *flag.FlagSet, keys ...string) {
+	allowed := villa.NewStrSet(keys...)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !allowed.In(f.Name) {
+			return
+		} // if
+		value := f.Value.String()
+		if bf, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		}); !ok || !bf.IsBoolFlag() {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				value = strconv.Quote(value)
+			} // if
+		} // if
+		fmtp.Fprintfln(w, "%s = %s", f.Name, value)
+	})
+}
@@ -0,0 +1,93 @@
+package godiff
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestParseTOML(t *testing.T) {
+	settings, err := parseTOML(`
+# go-diff settings
+normalize = true
+ignore = ["String", '*_gen'] # patterns
+context = 3
+name = "a # b"
+theme = "dark" # comment
+quote = "a \" # b" # comment
+`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "settings", settings, map[string]string{
+		"normalize": "true",
+		"ignore":    "String,*_gen",
+		"context":   "3",
+		"name":      "a # b",
+		"theme":     "dark",
+		"quote":     `a " # b`,
+	})
+
+	_, err = parseTOML("[table]")
+	assert.Equal(t, "err != nil", err != nil, true)
+}
+
+func TestApplyConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+	sub := filepath.Join(dir, "sub")
+	assert.NoError(t, os.Mkdir(sub, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".go-diff.json"),
+		[]byte(`{"normalize": true, "ignore": ["String", "*_gen"]}`), 0644))
+
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "none"))
+	fns := FindConfigs(sub)
+	assert.StringEqual(t, "fns", fns, []string{filepath.Join(dir, ".go-diff.json")})
+	assert.StringEqual(t, "ConfigDir", ConfigDir([]string{filepath.Join(sub, "a.go"), "b.go"}), sub)
+	assert.StringEqual(t, "ConfigDir merge", ConfigDir([]string{"merge", filepath.Join(sub, "a.go"), "b.go", "c.go"}), sub)
+	assert.StringEqual(t, "ConfigDir stdin", ConfigDir([]string{"-", "b.go"}), "")
+
+	// The nearest config wins over the one in the repository root.
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(sub, ".go-diff.toml"), []byte("order = true\n"), 0644))
+	assert.StringEqual(t, "nearest", FindConfigs(sub), []string{filepath.Join(sub, ".go-diff.toml")})
+
+	var options Options
+	fs := flag.NewFlagSet("go-diff", flag.ContinueOnError)
+	fs.BoolVar(&options.Normalize, "normalize", false, "")
+	fs.BoolVar(&options.Ordered, "order", false, "")
+	ignore := fs.String("ignore", "", "")
+	printConfig := fs.Bool("print-config", false, "")
+	keys := []string{"normalize", "order", "ignore"}
+	// Flags override the config.
+	assert.NoError(t, fs.Parse([]string{"-normalize=false", "-order"}))
+	if !assert.NoError(t, ApplyConfigs(fs, fns, keys...)) {
+		return
+	}
+	assert.Equal(t, "Normalize", options.Normalize, false)
+	assert.Equal(t, "Ordered", options.Ordered, true)
+	assert.Equal(t, "ignore", *ignore, "String,*_gen")
+
+	var buf bytesp.Slice
+	PrintConfig(&buf, fs, keys...)
+	assert.StringEqual(t, "config", string(buf), `ignore = "String,*_gen"
+normalize = false
+order = true
+`)
+
+	// Only the keys may be set by a config.
+	fn := filepath.Join(dir, "bad.toml")
+	assert.NoError(t, ioutil.WriteFile(fn, []byte("print-config = true\n"), 0644))
+	assert.Equal(t, "print-config err != nil", ApplyConfigs(fs, []string{fn}, keys...) != nil, true)
+	assert.Equal(t, "printConfig", *printConfig, false)
+}
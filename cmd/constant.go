@@ -0,0 +1,513 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// constDef is a named constant with the implicit repetition of its const block
+// resolved.
+type constDef struct {
+	name string
+	tp   ast.Expr // nil for untyped constants
+	expr ast.Expr
+	iota int
+
+	value     constant.Value
+	evaluated bool
+}
+
+type constDefs struct {
+	defs   []*constDef
+	byName map[string]*constDef
+	byDecl map[*ast.GenDecl][]*constDef
+	// types are the global type declarations, for resolving the basic types
+	// of typed constants and conversions.
+	types map[string]ast.Expr
+}
+
+// remove removes the constants declared in a const block whose names match,
+// or all of them if match is nil. They are still used to evaluate other
+// constants.
+func (cds *constDefs) remove(d *ast.GenDecl, match func(name string) bool) {
+	removed := make(map[*constDef]bool)
+	var kept []*constDef
+	for _, cd := range cds.byDecl[d] {
+		if match != nil && !match(cd.name) {
+			kept = append(kept, cd)
+			continue
+		} // if
+		removed[cd] = true
+	} // for cd
+	if len(kept) == 0 {
+		delete(cds.byDecl, d)
+	} else {
+		cds.byDecl[d] = kept
+	} // else
+	defs := cds.defs[:0]
+	for _, cd := range cds.defs {
+		if !removed[cd] {
+			defs = append(defs, cd)
+		} // if
+	} // for cd
+	cds.defs = defs
+}
+
+// collectConsts finds all global constants in a file and evaluates them.
+func collectConsts(f *ast.File) *constDefs {
+	cds := &constDefs{
+		byName: make(map[string]*constDef),
+		byDecl: make(map[*ast.GenDecl][]*constDef),
+		types:  make(map[string]ast.Expr),
+	}
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if ok && d.Tok == token.TYPE {
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				cds.types[ts.Name.Name] = ts.Type
+			} // for spec
+		} // if
+		if !ok || d.Tok != token.CONST {
+			continue
+		} // if
+
+		var tp ast.Expr
+		var values []ast.Expr
+		for i, spec := range d.Specs {
+			sp := spec.(*ast.ValueSpec)
+			if sp.Type != nil || len(sp.Values) > 0 {
+				// A new expression list, otherwise the previous one is repeated.
+				tp, values = sp.Type, sp.Values
+			} // if
+			for j, name := range sp.Names {
+				if j >= len(values) {
+					continue
+				} // if
+				cd := &constDef{name: name.Name, tp: tp, expr: values[j], iota: i}
+				cds.byDecl[d] = append(cds.byDecl[d], cd)
+				if cd.name == "_" {
+					continue
+				} // if
+				cds.defs = append(cds.defs, cd)
+				cds.byName[cd.name] = cd
+			} // for j, name
+		} // for i, spec
+	} // for decl
+
+	for _, defs := range cds.byDecl {
+		for _, cd := range defs {
+			cds.eval(cd)
+		} // for cd
+	} // for defs
+	return cds
+}
+
+func (cds *constDefs) eval(cd *constDef) constant.Value {
+	if !cd.evaluated {
+		// Marks as evaluated first, so that circular definitions are unknown.
+		cd.evaluated, cd.value = true, constant.MakeUnknown()
+		cd.value = cds.evalExpr(cd.expr, cd.iota)
+		if cd.tp != nil {
+			cd.value = cds.convert(cd.value, cd.tp)
+		} // if
+	} // if
+	return cd.value
+}
+
+// basicType returns the name of the basic type tp is, or is defined as in the
+// file, or "" if unknown.
+func (cds *constDefs) basicType(tp ast.Expr) string {
+	// limited to break circular definitions
+	for i := 0; i < 16; i++ {
+		switch x := tp.(type) {
+		case *ast.ParenExpr:
+			tp = x.X
+		case *ast.Ident:
+			u, ok := cds.types[x.Name]
+			if !ok {
+				return x.Name
+			} // if
+			tp = u
+		default:
+			return ""
+		}
+	} // for i
+	return ""
+}
+
+// convert converts a constant value to type tp. An unknown value is returned
+// if tp is not a known basic type or the value is not representable, e.g. an
+// integer type of 1.5.
+func (cds *constDefs) convert(v constant.Value, tp ast.Expr) constant.Value {
+	if v.Kind() == constant.Unknown {
+		return v
+	} // if
+	switch cds.basicType(tp) {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+		"uintptr", "byte", "rune":
+		return constant.ToInt(v)
+	case "float32", "float64":
+		return constant.ToFloat(v)
+	case "complex64", "complex128":
+		return constant.ToComplex(v)
+	case "string":
+		if v.Kind() == constant.String {
+			return v
+		} // if
+	case "bool":
+		if v.Kind() == constant.Bool {
+			return v
+		} // if
+	}
+	return constant.MakeUnknown()
+}
+
+// evalExpr evaluates a constant expression. An unknown value is returned if e
+// cannot be evaluated syntactically.
+func (cds *constDefs) evalExpr(e ast.Expr, iota int) constant.Value {
+	switch x := e.(type) {
+	case *ast.BasicLit:
+		return constant.MakeFromLiteral(x.Value, x.Kind, 0)
+
+	case *ast.Ident:
+		switch x.Name {
+		case "iota":
+			return constant.MakeInt64(int64(iota))
+		case "true", "false":
+			return constant.MakeBool(x.Name == "true")
+		}
+		if cd, ok := cds.byName[x.Name]; ok {
+			return cds.eval(cd)
+		} // if
+
+	case *ast.ParenExpr:
+		return cds.evalExpr(x.X, iota)
+
+	case *ast.UnaryExpr:
+		v := cds.evalExpr(x.X, iota)
+		if v.Kind() == constant.Unknown {
+			return v
+		} // if
+		switch x.Op {
+		case token.ADD, token.SUB, token.XOR, token.NOT:
+			return constant.UnaryOp(x.Op, v, 0)
+		}
+
+	case *ast.BinaryExpr:
+		a, b := cds.evalExpr(x.X, iota), cds.evalExpr(x.Y, iota)
+		if a.Kind() == constant.Unknown || b.Kind() == constant.Unknown {
+			return constant.MakeUnknown()
+		} // if
+		return binaryOp(a, x.Op, b)
+
+	case *ast.CallExpr:
+		if len(x.Args) != 1 {
+			break
+		} // if
+		v := cds.evalExpr(x.Args[0], iota)
+		if fn, ok := x.Fun.(*ast.Ident); ok && fn.Name == "len" {
+			if v.Kind() == constant.String {
+				return constant.MakeInt64(int64(len(constant.StringVal(v))))
+			} // if
+			break
+		} // if
+		// a conversion, e.g. float64(10)
+		return cds.convert(v, x.Fun)
+	}
+
+	return constant.MakeUnknown()
+}
+
+// typeOf returns the type of a constant expression, e.g. T of T(5) or of a
+// constant declared with type T, or nil if it is untyped.
+func (cds *constDefs) typeOf(e ast.Expr) ast.Expr {
+	// limited to break circular definitions
+	for i := 0; i < 16; i++ {
+		switch x := e.(type) {
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.UnaryExpr:
+			e = x.X
+		case *ast.CallExpr:
+			if fn, ok := x.Fun.(*ast.Ident); ok && fn.Name == "len" {
+				return nil
+			} // if
+			return x.Fun
+		case *ast.Ident:
+			cd, ok := cds.byName[x.Name]
+			if !ok {
+				return nil
+			} // if
+			if cd.tp != nil {
+				return cd.tp
+			} // if
+			e = cd.expr
+		case *ast.BinaryExpr:
+			switch x.Op {
+			case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+				return nil
+			case token.SHL, token.SHR:
+				e = x.X
+				continue
+			}
+			if tp := cds.typeOf(x.X); tp != nil {
+				return tp
+			} // if
+			e = x.Y
+		default:
+			return nil
+		}
+	} // for i
+	return nil
+}
+
+func binaryOp(a constant.Value, op token.Token, b constant.Value) (v constant.Value) {
+	defer func() {
+		// go/constant panics on invalid operations, e.g. mismatched kinds.
+		if r := recover(); r != nil {
+			v = constant.MakeUnknown()
+		} // if
+	}()
+
+	switch op {
+	case token.SHL, token.SHR:
+		s, ok := constant.Uint64Val(constant.ToInt(b))
+		if !ok {
+			return constant.MakeUnknown()
+		} // if
+		return constant.Shift(a, op, uint(s))
+
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return constant.MakeBool(constant.Compare(a, op, b))
+
+	case token.QUO, token.REM:
+		if constant.Sign(b) == 0 {
+			return constant.MakeUnknown()
+		} // if
+		if op == token.QUO && a.Kind() == constant.Int && b.Kind() == constant.Int {
+			op = token.QUO_ASSIGN // integer division
+		} // if
+	}
+
+	return constant.BinaryOp(a, op, b)
+}
+
+// foldExpr returns the value of e as a fragment if e is a constant expression,
+// or the source of e otherwise.
+func foldExpr(fs *token.FileSet, cds *constDefs, e ast.Expr, iota int) diffFragment {
+	v := cds.evalExpr(e, iota)
+	if v.Kind() == constant.Unknown {
+		return newExpDef(fs, e)
+	} // if
+	return &stringFrag{weight: 100, source: cds.foldedString(v, e)}
+}
+
+// foldedString returns the value of a constant expression with its type, if
+// any, e.g. T(5), or as a literal of its untyped kind, e.g. 'a' or 2.0.
+func (cds *constDefs) foldedString(v constant.Value, e ast.Expr) string {
+	if tp := cds.typeOf(e); tp != nil {
+		return exprString(tp) + "(" + constValueString(v) + ")"
+	} // if
+	return cds.untypedString(v, e)
+}
+
+// untypedString returns the value of an untyped constant expression as a
+// literal of its kind, so that e.g. 'a' and 97 are different.
+func (cds *constDefs) untypedString(v constant.Value, e ast.Expr) string {
+	if v.Kind() == constant.Int && cds.isRune(e, 0) {
+		if r, ok := constant.Int64Val(v); ok && utf8.ValidRune(rune(r)) {
+			return strconv.QuoteRune(rune(r))
+		} // if
+		return "rune(" + v.String() + ")"
+	} // if
+	return constValueString(v)
+}
+
+// isRune returns true if an untyped constant expression is of the rune kind.
+func (cds *constDefs) isRune(e ast.Expr, depth int) bool {
+	if depth > 16 {
+		// a circular definition
+		return false
+	} // if
+	switch x := e.(type) {
+	case *ast.BasicLit:
+		return x.Kind == token.CHAR
+	case *ast.Ident:
+		cd, ok := cds.byName[x.Name]
+		return ok && cd.tp == nil && cds.isRune(cd.expr, depth+1)
+	case *ast.ParenExpr:
+		return cds.isRune(x.X, depth+1)
+	case *ast.UnaryExpr:
+		return cds.isRune(x.X, depth+1)
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.SHL, token.SHR:
+			return cds.isRune(x.X, depth+1)
+		}
+		return cds.isRune(x.X, depth+1) || cds.isRune(x.Y, depth+1)
+	}
+	return false
+}
+
+// newFoldedConstDecl is similar to newConstDecl but each constant is in its
+// own line with the value evaluated, so that only the values and types are
+// compared.
+func newFoldedConstDecl(fs *token.FileSet, cds *constDefs, d *ast.GenDecl) *fragment {
+	f := &fragment{tp: df_CONST, node: d}
+	for _, cd := range cds.byDecl[d] {
+		tpExpr := cd.tp
+		var value diffFragment
+		if cd.value.Kind() == constant.Unknown {
+			value = newExpDef(fs, cd.expr)
+		} else {
+			if tpExpr == nil {
+				// the type of a conversion, e.g. T(5)
+				tpExpr = cds.typeOf(cd.expr)
+			} // if
+			source := constValueString(cd.value)
+			if tpExpr == nil {
+				source = cds.untypedString(cd.value, cd.expr)
+			} // if
+			value = &stringFrag{weight: 100, source: source}
+		} // else
+
+		var tp diffFragment = (*fragment)(nil)
+		if tpExpr != nil {
+			tp = newTypeDef(fs, tpExpr)
+		} // if
+
+		f.Parts = append(f.Parts, &fragment{tp: df_VAR_LINE, Parts: []diffFragment{
+			&fragment{tp: df_NAMES, Parts: []diffFragment{&stringFrag{weight: 100, source: cd.name}}},
+			tp,
+			&fragment{tp: df_VALUES, Parts: []diffFragment{value}},
+		}})
+	} // for cd
+	return f
+}
+
+// newFoldedVarDecl is similar to newVarDecl but constant expressions in the
+// values are evaluated.
+func newFoldedVarDecl(fs *token.FileSet, cds *constDefs, spec *ast.ValueSpec) *fragment {
+	f := newVarDecl(fs, spec)
+	values := f.Parts[0].(*fragment).Parts[2].(*fragment)
+	for i, v := range spec.Values {
+		values.Parts[i] = foldExpr(fs, cds, v, 0)
+	} // for i, v
+	return f
+}
+
+// annotateFoldedVars shows the changed values of matched var declarations
+// whose values are constant expressions.
+func annotateFoldedVars(orgInfo *fileInfo, orgF diffFragment, newInfo *fileInfo, newF diffFragment) {
+	orgSpec, ok1 := orgF.(*fragment).node.(*ast.ValueSpec)
+	newSpec, ok2 := newF.(*fragment).node.(*ast.ValueSpec)
+	if !ok1 || !ok2 {
+		return
+	} // if
+
+	orgValues := make(map[string]string)
+	for i, name := range orgSpec.Names {
+		if i < len(orgSpec.Values) {
+			if v := orgInfo.consts.evalExpr(orgSpec.Values[i], 0); v.Kind() != constant.Unknown {
+				orgValues[name.Name] = orgInfo.consts.foldedString(v, orgSpec.Values[i])
+			} // if
+		} // if
+	} // for i, name
+	for i, name := range newSpec.Names {
+		if i >= len(newSpec.Values) {
+			continue
+		} // if
+		ov, ok := orgValues[name.Name]
+		if !ok {
+			continue
+		} // if
+		v := newInfo.consts.evalExpr(newSpec.Values[i], 0)
+		if v.Kind() == constant.Unknown {
+			continue
+		} // if
+		if nv := newInfo.consts.foldedString(v, newSpec.Values[i]); nv != ov {
+			showWarnLine(fmt.Sprintf("var %s: value changed from %s to %s", name.Name, ov, nv))
+		} // if
+	} // for i, name
+}
+
+// annotateUnmatchedVars shows the changed values of deleted and inserted var
+// declarations of the same names, e.g. var x = 1 and var x = 2 which are too
+// different to be matched.
+func annotateUnmatchedVars(orgInfo *fileInfo, orgParts []diffFragment, newInfo *fileInfo, newParts []diffFragment, matA, matB []int) {
+	deleted := make(map[string]diffFragment)
+	for i, j := range matA {
+		if j < 0 {
+			deleted[symbolsKey(orgInfo, orgParts[i])] = orgParts[i]
+		} // if
+	} // for i, j
+	for j, i := range matB {
+		if i >= 0 {
+			continue
+		} // if
+		if o, ok := deleted[symbolsKey(newInfo, newParts[j])]; ok && selected(newInfo, newParts[j]) {
+			annotateFoldedVars(orgInfo, o, newInfo, newParts[j])
+		} // if
+	} // for j, i
+}
+
+// constValueString returns the short form of a value, e.g. 1.5 rather than
+// 3/2, if it is exact. Floats are always in a float form, e.g. 2.0 rather
+// than 2.
+func constValueString(v constant.Value) string {
+	switch v.Kind() {
+	case constant.String:
+		return strconv.Quote(constant.StringVal(v))
+	case constant.Float:
+		if s := v.String(); sameValue(constant.MakeFromLiteral(s, token.FLOAT, 0), v) {
+			if !strings.ContainsAny(s, ".eE") {
+				s += ".0"
+			} // if
+			return s
+		} // if
+	}
+	return v.ExactString()
+}
+
+// sameValue returns true if two values are equal, e.g. 1 and 1.0.
+func sameValue(a, b constant.Value) (same bool) {
+	defer func() {
+		// go/constant panics on mismatched kinds.
+		if r := recover(); r != nil {
+			same = false
+		} // if
+	}()
+	return constant.Compare(a, token.EQL, b)
+}
+
+/*
+   Diff Const Values
+
+   Warns when the effective value of an existing named constant changes while
+   its expression does not, e.g. a constant inserted in the middle of an iota
+   block. Changed expressions are already shown in the diff.
+*/
+func diffConstValues(orgInfo, newInfo *fileInfo) {
+	orgConsts, newConsts := orgInfo.consts, newInfo.consts
+
+	for _, nd := range newConsts.defs {
+		od, ok := orgConsts.byName[nd.name]
+		if !ok || !matchOnly(nd.name) {
+			continue
+		} // if
+		if od.value.Kind() == constant.Unknown || nd.value.Kind() == constant.Unknown {
+			continue
+		} // if
+		if exprString(od.expr) != exprString(nd.expr) || sameValue(od.value, nd.value) {
+			continue
+		} // if
+		showWarnLine(fmt.Sprintf("const %s: effective value changed from %s to %s", nd.name,
+			constValueString(od.value), constValueString(nd.value)))
+	} // for nd
+}
@@ -0,0 +1,218 @@
+package godiff
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestCollectConsts(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", `
+package main
+
+const (
+	A = iota * 10
+	B
+	_
+	C
+)
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+)
+
+const S, L = "a" + "b", len(S)
+
+type Dur int64
+
+const D = Dur(C) / 7
+
+const E = time.Duration(1)
+
+const F, G = float64(3) / 2, F / 2
+
+const H float32 = 3
+
+const I = H / 2
+`, 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var values []string
+	for _, cd := range collectConsts(f).defs {
+		values = append(values, cd.name+"="+constValueString(cd.value))
+	}
+	assert.StringEqual(t, "values", values, `[A=0 B=10 C=30 KB=1024 MB=1048576 S="ab" L=2 D=4 E=unknown F=1.5 G=0.75 H=3.0 I=1.5]`)
+}
+
+func TestDiff_IotaShift(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+
+	orgInfo, err := parse("", `
+package main
+
+const (
+	Red = iota
+	Green
+	Blue
+)
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+const (
+	Red = iota
+	Yellow
+	Green
+	Blue
+)
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffConstValues(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", strings.Split(string(buf), "\n"), strings.Split(
+		`!!! const Green: effective value changed from 1 to 2
+!!! const Blue: effective value changed from 2 to 3
+`, "\n"))
+}
+
+func TestDiff_FoldConsts(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{FoldConsts: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+const (
+	KB = 1 << 10
+	Name = "a" + "b"
+	Max int = 10
+)
+
+var size = 2 * KB
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+const (
+	KB = 1024
+	Name = "ab"
+	Max int64 = 10
+)
+
+var size = 2048
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffVars(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", strings.Split(string(buf), "\n"), strings.Split(
+		`    const(
+        KB = 1024
+        Name = "ab"
+---     Max int = 10
++++     Max int64 = 10
+    )
+
+`, "\n"))
+}
+
+func TestDiff_ConstFloat(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	for _, c := range [][2]string{
+		{"const A = float64(3) / 2\n", "const A = 1.5\n"},
+		{"const A float64 = 3\n\nconst B = A / 2\n", "const A float64 = 3\n\nconst B = 1.5\n"},
+		{"type T int\n\nconst A T = 3\n\nconst B = A / 2\n", "type T int\n\nconst A T = 3\n\nconst B = 1\n"},
+	} {
+		var buf bytesp.Slice
+		_, err := DiffSource("a.go", []byte("package main\n\n"+c[0]), "b.go", []byte("package main\n\n"+c[1]), &buf, Options{NoColor: true})
+		assert.NoError(t, err)
+		assert.Equal(t, c[0]+" warned", strings.Contains(string(buf), "!!!"), false)
+	} // for c
+
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte("package main\n\nconst C = 3.0\n\nconst A = C / 2\n"),
+		"b.go", []byte("package main\n\nconst C = 5.0\n\nconst A = C / 2\n"), &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "value changed", strings.Contains(string(buf), "!!! const A: effective value changed from 1.5 to 2.5"), true)
+	assert.Equal(t, "changed expr warned", strings.Contains(string(buf), "!!! const C:"), false)
+}
+
+func TestDiff_FoldConstsTypes(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte(`package main
+
+type T int
+
+const Conv = T(5)
+
+var limit = 1 << 10
+
+var typed = T(1) << 2
+`), "b.go", []byte(`package main
+
+type T int
+
+const Conv = 5
+
+var limit = 2048
+
+var typed = 4
+`), &buf, Options{NoColor: true, FoldConsts: true})
+	assert.NoError(t, err)
+	assert.StringEqual(t, "diff", strings.Split(string(buf), "\n"), strings.Split(`--- const Conv T = 5
++++ const Conv = 5
+
+--- var limit = 1024
+--- var typed = T(4)
++++ var limit = 2048
++++ var typed = 4
+!!! var limit: value changed from 1024 to 2048
+!!! var typed: value changed from T(4) to 4
+`, "\n"))
+}
+
+func TestDiff_FoldConstsKinds(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	for _, c := range []struct {
+		org, new string
+		differ   bool
+	}{
+		{"var v = 2.0", "var v = 2", true},
+		{"const X = 1.0", "const X = 1", true},
+		{"var r = 'a'", "var r = 97", true},
+		{"const C = 'a'", "const C = 'b' - 1", false},
+		{"var f = 2.0", "var f = 1.0 * 2", false},
+		{"var n = 1 << 3", "var n = 8", false},
+	} {
+		var buf bytesp.Slice
+		differ, err := DiffSource("a.go", []byte("package main\n\n"+c.org+"\n"), "b.go", []byte("package main\n\n"+c.new+"\n"),
+			&buf, Options{NoColor: true, FoldConsts: true})
+		assert.NoError(t, err)
+		assert.Equal(t, c.org+" -> "+c.new, differ, c.differ)
+	} // for c
+}
@@ -0,0 +1,157 @@
+package godiff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// symbolsKey returns the sorted symbols declared by a fragment as a key.
+func symbolsKey(info *fileInfo, f diffFragment) string {
+	syms := partSymbols(info, f)
+	sort.Strings(syms)
+	return strings.Join(syms, ",")
+}
+
+// showSide shows the change of a side from base, nil for a deleted one.
+func showSide(side string, baseF, sideF diffFragment) {
+	showNoteLine(side + ":")
+	if sideF == nil {
+		showDelWholeLine(baseF.oneLine())
+		return
+	} // if
+	baseF.showDiff(sideF)
+}
+
+// diff3Parts shows the three-way difference of the fragments of a group.
+func diff3Parts(base *fileInfo, baseParts []diffFragment, ours *fileInfo, oursParts []diffFragment,
+	theirs *fileInfo, theirsParts []diffFragment) {
+	_, bo, ob := matchParts(baseParts, oursParts)
+	_, bt, tb := matchParts(baseParts, theirsParts)
+
+	changed := func(a, b diffFragment) bool {
+		return a.calcDiff(b) > 0
+	}
+	// change returns how a side changed a base fragment, "" if unchanged.
+	change := func(b, f diffFragment) string {
+		if f == nil {
+			return "deleted"
+		} // if
+		if changed(b, f) {
+			return "changed"
+		} // if
+		return ""
+	}
+	for i, b := range baseParts {
+		var o, t diffFragment
+		if bo[i] >= 0 {
+			o = oursParts[bo[i]]
+		} // if
+		if bt[i] >= 0 {
+			t = theirsParts[bt[i]]
+		} // if
+		oc, tc := change(b, o), change(b, t)
+
+		var status string
+		switch {
+		case oc == "" && tc == "":
+			continue
+		case tc == "":
+			status = oc + " in ours"
+		case oc == "":
+			status = tc + " in theirs"
+		case oc == "deleted" && tc == "deleted":
+			status = "deleted in both"
+		case oc == "changed" && tc == "changed" && !changed(o, t):
+			status = "changed in both identically"
+		case oc == tc:
+			status = "changed in both differently"
+		default:
+			status = oc + " in ours, " + tc + " in theirs"
+		}
+		showNoteLine(fmt.Sprintf("%s: %s", b.oneLine(), status))
+
+		switch status {
+		case "deleted in both":
+		case "changed in both identically":
+			showSide("ours and theirs", b, o)
+		default:
+			if oc != "" {
+				showSide("ours", b, o)
+			} // if
+			if tc != "" {
+				showSide("theirs", b, t)
+			} // if
+		}
+	} // for i, b
+
+	theirsAdded := make(map[string]diffFragment)
+	for j, i := range tb {
+		if i < 0 {
+			theirsAdded[symbolsKey(theirs, theirsParts[j])] = theirsParts[j]
+		} // if
+	} // for j, i
+	for j, i := range ob {
+		if i >= 0 {
+			continue
+		} // if
+		o := oursParts[j]
+		key := symbolsKey(ours, o)
+		t, ok := theirsAdded[key]
+		if !ok {
+			showNoteLine(fmt.Sprintf("%s: added in ours", o.oneLine()))
+			showInsWholeLine(o.oneLine())
+			continue
+		} // if
+		delete(theirsAdded, key)
+		if !changed(o, t) {
+			showNoteLine(fmt.Sprintf("%s: added in both identically", o.oneLine()))
+			showInsWholeLine(o.oneLine())
+			continue
+		} // if
+		showNoteLine(fmt.Sprintf("%s: added in both differently", o.oneLine()))
+		showNoteLine("ours to theirs:")
+		o.showDiff(t)
+	} // for j, i
+	for j, i := range tb {
+		if t := theirsParts[j]; i < 0 && theirsAdded[symbolsKey(theirs, t)] == t {
+			showNoteLine(fmt.Sprintf("%s: added in theirs", t.oneLine()))
+			showInsWholeLine(t.oneLine())
+		} // if
+	} // for j, i
+}
+
+func diff3(base, ours, theirs *fileInfo) {
+	diff3Parts(base, base.types.Parts, ours, ours.types.Parts, theirs, theirs.types.Parts)
+	diff3Parts(base, base.vars.Parts, ours, ours.vars.Parts, theirs, theirs.vars.Parts)
+	diff3Parts(base, base.funcs.Parts, ours, ours.funcs.Parts, theirs, theirs.funcs.Parts)
+}
+
+// ExecDiff3 prints into w, for each declaration, whether it changed in ours,
+// in theirs, in both identically or in both differently, with the changes of
+// each side from base. differ is true if any side changed. Not thread-safe.
+func ExecDiff3(baseFn, oursFn, theirsFn string, w io.Writer, options Options) (differ bool, err error) {
+	if err := checkStdin(baseFn, oursFn, theirsFn); err != nil {
+		return false, err
+	} // if
+	w, finish := setupWriter(w, &options)
+	defer finish()
+	gOut = w
+	gOptions = options
+	gDiffs = 0
+
+	var infos [3]*fileInfo
+	for i, fn := range []string{baseFn, oursFn, theirsFn} {
+		src, err := readSource(fn)
+		if err != nil {
+			return false, err
+		} // if
+		if infos[i], err = parse(fn, src); err != nil {
+			return false, err
+		} // if
+	} // for i, fn
+
+	diff3(infos[0], infos[1], infos[2])
+	return gDiffs > 0, nil
+}
@@ -0,0 +1,143 @@
+package godiff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestDiff3(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	defer func() { gOptions = Options{} }()
+
+	parseSrc := func(src string) *fileInfo {
+		info, err := parse("", src)
+		assert.NoError(t, err)
+		return info
+	}
+	base := parseSrc(`
+package main
+
+func a() int {
+	return 1
+}
+
+func b() int {
+	return 1
+}
+
+func c() int {
+	return 1
+}
+
+func d() {
+}
+	`)
+	ours := parseSrc(`
+package main
+
+func a() int {
+	return 2
+}
+
+func b() int {
+	return 2
+}
+
+func c() int {
+	return 2
+}
+
+func e() {
+}
+	`)
+	theirs := parseSrc(`
+package main
+
+func a() int {
+	return 1
+}
+
+func b() int {
+	return 2
+}
+
+func c() int {
+	return 3
+}
+
+func d() {
+}
+	`)
+
+	diff3(base, ours, theirs)
+
+	assert.StringEqual(t, "diff3", string(buf), `::: func a() int { ... } (3 lines): changed in ours
+::: ours:
+    func a() int {
+---     return 1
++++     return 2
+    }
+::: func b() int { ... } (3 lines): changed in both identically
+::: ours and theirs:
+    func b() int {
+---     return 1
++++     return 2
+    }
+::: func c() int { ... } (3 lines): changed in both differently
+::: ours:
+    func c() int {
+---     return 1
++++     return 2
+    }
+::: theirs:
+    func c() int {
+---     return 1
++++     return 3
+    }
+::: func d() { ... } (2 lines): deleted in ours
+::: ours:
+=== func d() { ... } (2 lines)
+::: func e() { ... } (2 lines): added in ours
+### func e() { ... } (2 lines)
+`)
+}
+
+func TestExecDiff3_Colors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-diff3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() { gOptions = Options{} }()
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	defer os.Setenv("FORCE_COLOR", os.Getenv("FORCE_COLOR"))
+
+	var fns []string
+	for i, src := range []string{"var a = 1\n", "var a = 2\n", "var a = 1\n"} {
+		fn := filepath.Join(dir, string(rune('a'+i))+".go")
+		assert.NoError(t, ioutil.WriteFile(fn, []byte("package main\n\n"+src), 0644))
+		fns = append(fns, fn)
+	} // for i, src
+
+	os.Setenv("NO_COLOR", "1")
+	os.Setenv("FORCE_COLOR", "")
+	var buf bytesp.Slice
+	differ, err := ExecDiff3(fns[0], fns[1], fns[2], &buf, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "differ", differ, true)
+	assert.Equal(t, "NO_COLOR", strings.Contains(string(buf), "\x1b"), false)
+
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("FORCE_COLOR", "1")
+	buf = nil
+	_, err = ExecDiff3(fns[0], fns[1], fns[2], &buf, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "FORCE_COLOR", strings.Contains(string(buf), "\x1b["), true)
+}
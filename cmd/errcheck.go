@@ -0,0 +1,206 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errHandling collects the error handling of a function body. Each field is a
+// multiset of printed sources.
+type errHandling struct {
+	checks    map[string]int // if err != nil
+	ignored   map[string]int // assignments of errors to _
+	swallowed map[string]int // error checks neither using nor returning the error
+	wraps     map[string]int // fmt.Errorf formats
+}
+
+func isErrName(name string) bool {
+	return name == "err" || strings.HasSuffix(name, "Err") || strings.HasSuffix(name, "err")
+}
+
+// errCheckName returns the name of the error if cond is like err != nil or
+// nil != err.
+func errCheckName(cond ast.Expr) string {
+	b, ok := cond.(*ast.BinaryExpr)
+	if !ok || b.Op != token.NEQ {
+		return ""
+	} // if
+	x := b.X
+	if isLiteral(x, "nil") {
+		x = b.Y
+	} else if !isLiteral(b.Y, "nil") {
+		return ""
+	} // else if
+	if id, ok := x.(*ast.Ident); ok && isErrName(id.Name) {
+		return id.Name
+	} // if
+	return ""
+}
+
+// usesName returns true if the name is referenced in any of the nodes.
+func usesName(name string, nodes ...ast.Expr) (used bool) {
+	for _, nd := range nodes {
+		ast.Inspect(nd, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == name {
+				used = true
+			} // if
+			return !used
+		})
+	} // for nd
+	return used
+}
+
+// isTerminating returns true if call panics or exits, e.g. log.Fatal(err).
+func isTerminating(call *ast.CallExpr) bool {
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		return fn.Name == "panic"
+	case *ast.SelectorExpr:
+		switch fn.Sel.Name {
+		case "Fatal", "Fatalf", "Fatalln", "Panic", "Panicf", "Panicln", "Exit":
+			return true
+		}
+	}
+	return false
+}
+
+// handlesErr returns true if blk propagates the error: returns it, with a
+// bare return for a named error, panics, exits, or assigns it to something
+// else. Merely logging it does not count.
+func handlesErr(blk *ast.BlockStmt, name string) (handled bool) {
+	ast.Inspect(blk, func(n ast.Node) bool {
+		switch nd := n.(type) {
+		case *ast.FuncLit:
+			// returns in closures do not return from the function
+			return false
+		case *ast.ReturnStmt:
+			if len(nd.Results) == 0 || usesName(name, nd.Results...) {
+				handled = true
+			} // if
+		case *ast.CallExpr:
+			if isTerminating(nd) {
+				handled = true
+			} // if
+		case *ast.AssignStmt:
+			if usesName(name, nd.Rhs...) {
+				handled = true
+			} // if
+		}
+		return !handled
+	})
+	return handled
+}
+
+// errorfFormat returns the format of a fmt.Errorf call.
+func errorfFormat(call *ast.CallExpr) (string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Errorf" || len(call.Args) == 0 {
+		return "", false
+	} // if
+	if id, ok := sel.X.(*ast.Ident); !ok || id.Name != "fmt" {
+		return "", false
+	} // if
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	} // if
+	format, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	} // if
+	return format, true
+}
+
+func newErrHandling(fd *ast.FuncDecl) *errHandling {
+	eh := &errHandling{
+		checks:    make(map[string]int),
+		ignored:   make(map[string]int),
+		swallowed: make(map[string]int),
+		wraps:     make(map[string]int),
+	}
+	if fd.Body == nil {
+		return eh
+	} // if
+
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		switch nd := n.(type) {
+		case *ast.IfStmt:
+			if name := errCheckName(nd.Cond); name != "" {
+				cond := exprString(nd.Cond)
+				eh.checks[cond]++
+				if !handlesErr(nd.Body, name) {
+					eh.swallowed[cond]++
+				} // if
+			} // if
+		case *ast.AssignStmt:
+			// Errors are conventionally the last results.
+			if len(nd.Rhs) != 1 || !isLiteral(nd.Lhs[len(nd.Lhs)-1], "_") {
+				break
+			} // if
+			if _, ok := nd.Rhs[0].(*ast.CallExpr); ok {
+				eh.ignored[strings.Join(printToLines(token.NewFileSet(), nd), " ")]++
+			} // if
+		case *ast.CallExpr:
+			if format, ok := errorfFormat(nd); ok {
+				eh.wraps[format]++
+			} // if
+		}
+		return true
+	})
+	return eh
+}
+
+// minus returns the sorted elements of a exceeding those in b.
+func minus(a, b map[string]int) (res []string) {
+	for el, cnt := range a {
+		if cnt > b[el] {
+			res = append(res, el)
+		} // if
+	} // for el, cnt
+	sort.Strings(res)
+	return res
+}
+
+// annotateErrHandling warns about error handling changes of a function.
+func annotateErrHandling(orgF, newF diffFragment) {
+	orgFd, ok1 := orgF.(*fragment).node.(*ast.FuncDecl)
+	newFd, ok2 := newF.(*fragment).node.(*ast.FuncDecl)
+	if !ok1 || !ok2 {
+		return
+	} // if
+	o, n := newErrHandling(orgFd), newErrHandling(newFd)
+
+	for _, c := range minus(o.checks, n.checks) {
+		showWarnLine(fmt.Sprintf("error check removed: if %s", c))
+	} // for c
+	for _, c := range minus(n.swallowed, o.swallowed) {
+		showWarnLine(fmt.Sprintf("error swallowed: if %s", c))
+	} // for c
+	for _, st := range minus(n.ignored, o.ignored) {
+		showWarnLine(fmt.Sprintf("error ignored: %s", st))
+	} // for st
+
+	// The same message with %w replaced by %v, or vice versa.
+	wrapped := func(format string) string {
+		return strings.Replace(format, "%w", "%v", -1)
+	}
+	orgFormats := make(map[string]string)
+	for format := range o.wraps {
+		orgFormats[wrapped(format)] = format
+	} // for format
+	for _, format := range minus(n.wraps, o.wraps) {
+		of, ok := orgFormats[wrapped(format)]
+		if !ok {
+			continue
+		} // if
+		if strings.Contains(of, "%w") && !strings.Contains(format, "%w") {
+			showWarnLine(fmt.Sprintf("error wrapping removed: %q to %q", of, format))
+		} else if !strings.Contains(of, "%w") && strings.Contains(format, "%w") {
+			showWarnLine(fmt.Sprintf("error wrapping added: %q to %q", of, format))
+		} // else if
+	} // for format
+}
@@ -0,0 +1,104 @@
+package godiff
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestDiff_ErrCheck(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{ErrCheck: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func load(fn string) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", fn, err)
+	}
+	n, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := read(f, n)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func load(fn string) ([]byte, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %v", fn, err)
+	}
+	n, _ := f.Stat()
+	data, err := read(f, n)
+	if err != nil {
+		return nil, nil
+	}
+	return data, nil
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffFuncs(orgInfo, newInfo)
+
+	var warnings []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, "!!!") {
+			warnings = append(warnings, line)
+		}
+	}
+	assert.StringEqual(t, "warnings", warnings, []string{
+		"!!! error check removed: if err != nil",
+		"!!! error swallowed: if err != nil",
+		"!!! error ignored: n, _ := f.Stat()",
+		`!!! error wrapping removed: "open %s: %w" to "open %s: %v"`,
+	})
+}
+
+func TestHandlesErr(t *testing.T) {
+	for _, c := range []struct {
+		src     string
+		handled bool
+	}{
+		{"if err != nil { return err }", true},
+		{"if err != nil { return fmt.Errorf(\"x: %w\", err) }", true},
+		{"if err != nil { return }", true},
+		{"if err != nil { panic(err) }", true},
+		{"if err != nil { log.Fatal(err) }", true},
+		{"if err != nil { firstErr = err }", true},
+		{"if nil != err { return err }", true},
+		{"if err != nil { log.Println(err) }", false},
+		{"if nil != err { log.Println(err) }", false},
+		{"if err != nil { return nil }", false},
+		{"if err != nil { go func() error { return err }() }", false},
+	} {
+		fd, err := parser.ParseFile(token.NewFileSet(), "", "package main\nfunc f() {\n"+c.src+"\n}", 0)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		ifStmt := fd.Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.IfStmt)
+		name := errCheckName(ifStmt.Cond)
+		assert.StringEqual(t, c.src+" name", name, "err")
+		assert.Equal(t, c.src, handlesErr(ifStmt.Body, name), c.handled)
+	} // for c
+}
@@ -0,0 +1,199 @@
+package godiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golangplus/fmt"
+)
+
+// isGitMode returns true if s is a file mode argument of git, "." for a
+// missing file.
+func isGitMode(s string) bool {
+	if s == "." {
+		return true
+	} // if
+	_, err := strconv.ParseUint(s, 8, 32)
+	return err == nil
+}
+
+// IsGitArgs returns true if args are the arguments git passes to a
+// GIT_EXTERNAL_DIFF program:
+//
+//	path old-file old-hex old-mode new-file new-hex new-mode [new-path xfrm-msg]
+func IsGitArgs(args []string) bool {
+	return (len(args) == 7 || len(args) == 9) && isGitMode(args[3]) && isGitMode(args[6])
+}
+
+// isBinary returns true if the content looks binary, i.e. contains a NUL
+// byte in the first 8000 bytes like git checks.
+func isBinary(src []byte) bool {
+	if len(src) > 8000 {
+		src = src[:8000]
+	} // if
+	return bytes.IndexByte(src, 0) >= 0
+}
+
+func shortHex(hex string) string {
+	if hex == "." {
+		return "0000000"
+	} // if
+	if len(hex) > 7 {
+		return hex[:7]
+	} // if
+	return hex
+}
+
+// showGitHeader prints the header of a file diff in the format of git.
+func showGitHeader(oldPath, oldHex, oldMode, newPath, newHex, newMode, xfrm string) {
+	fmtp.Fprintfln(gOut, "diff --git a/%s b/%s", oldPath, newPath)
+	switch {
+	case oldMode == ".":
+		fmtp.Fprintfln(gOut, "new file mode %s", newMode)
+	case newMode == ".":
+		fmtp.Fprintfln(gOut, "deleted file mode %s", oldMode)
+	case oldMode != newMode:
+		fmtp.Fprintfln(gOut, "old mode %s", oldMode)
+		fmtp.Fprintfln(gOut, "new mode %s", newMode)
+	}
+	if xfrm = strings.TrimSpace(xfrm); xfrm != "" {
+		fmt.Fprintln(gOut, xfrm)
+	} // if
+	if oldHex != newHex {
+		fmtp.Fprintfln(gOut, "index %s..%s", shortHex(oldHex), shortHex(newHex))
+	} // if
+
+	a, b := "a/"+oldPath, "b/"+newPath
+	if oldMode == "." {
+		a = "/dev/null"
+	} // if
+	if newMode == "." {
+		b = "/dev/null"
+	} // if
+	fmtp.Fprintfln(gOut, "--- %s", a)
+	fmtp.Fprintfln(gOut, "+++ %s", b)
+}
+
+// ExecGit prints the difference of a file as a GIT_EXTERNAL_DIFF program to
+// w. A single argument is an unmerged path. Go files are diffed semantically,
+// other text files line by line. differ is true if any difference is found.
+// Not thread-safe.
+func ExecGit(args []string, w io.Writer, options Options) (differ bool, err error) {
+	// Colors are on if git's output, through its pager or not, is a terminal.
+	// They are always written into w as ANSI sequences.
+	setupColors(&options, os.Getenv("GIT_PAGER_IN_USE") != "" || isTerminal(os.Stdout))
+	defer func() { gANSI = false }()
+	gOut, gANSI = w, !options.NoColor
+	gOptions = options
+	gDiffs = 0
+
+	if len(args) == 1 {
+		fmtp.Fprintfln(gOut, "* Unmerged path %s", args[0])
+		return false, nil
+	} // if
+	if !IsGitArgs(args) {
+		return false, fmt.Errorf("unexpected arguments from git: %q", args)
+	} // if
+
+	oldPath, oldFile, oldHex, oldMode := args[0], args[1], args[2], args[3]
+	newFile, newHex, newMode := args[4], args[5], args[6]
+	newPath, xfrm := oldPath, ""
+	if len(args) == 9 {
+		newPath, xfrm = args[7], args[8]
+	} // if
+
+	oldSrc, err := readSource(oldFile)
+	if err != nil {
+		return false, err
+	} // if
+	newSrc, err := readSource(newFile)
+	if err != nil {
+		return false, err
+	} // if
+
+	showGitHeader(oldPath, oldHex, oldMode, newPath, newHex, newMode, xfrm)
+	differ = oldPath != newPath || oldMode != newMode
+
+	switch {
+	case isBinary(oldSrc) || isBinary(newSrc):
+		if !bytes.Equal(oldSrc, newSrc) {
+			fmtp.Fprintfln(gOut, "Binary files a/%s and b/%s differ", oldPath, newPath)
+			differ = true
+		} // if
+		return differ, nil
+
+	case path.Ext(oldPath) == ".go" || path.Ext(newPath) == ".go":
+		if oldMode == "." {
+			oldPath = "/dev/null"
+		} // if
+		if newMode == "." {
+			newPath = "/dev/null"
+		} // if
+		changed, err := DiffSource(oldPath, oldSrc, newPath, newSrc, w, options)
+		return differ || changed, err
+	}
+
+	diffLines(strings.Split(string(oldSrc), "\n"), strings.Split(string(newSrc), "\n"), "%s")
+	return differ || gDiffs > 0, nil
+}
+
+// Textconv prints a canonical form of a Go file to w for git's textconv:
+// declarations are formatted and sorted so that a plain line diff ignores
+// reordering. Non-Go or unparsable files are printed as is.
+func Textconv(w io.Writer, fn string) error {
+	src, err := readSource(fn)
+	if err != nil {
+		return err
+	} // if
+	if path.Ext(fn) != ".go" {
+		_, err := w.Write(src)
+		return err
+	} // if
+	info, err := parse(fn, src)
+	if err != nil {
+		_, err := w.Write(src)
+		return err
+	} // if
+
+	fmtp.Fprintfln(w, "package %s", info.f.Name)
+	var imports []string
+	for _, imp := range info.f.Imports {
+		s := imp.Path.Value
+		if imp.Name != nil {
+			s = imp.Name.Name + " " + s
+		} // if
+		imports = append(imports, s)
+	} // for imp
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmtp.Fprintfln(w, "import %s", imp)
+	} // for imp
+
+	for _, frag := range []*fragment{info.types, info.vars, info.funcs} {
+		type decl struct {
+			key   string
+			lines []string
+		}
+		decls := make([]decl, 0, len(frag.Parts))
+		for _, p := range frag.Parts {
+			lines := p.sourceLines("")
+			decls = append(decls, decl{key: strings.Join(partSymbols(info, p), ",") + "\n" + strings.Join(lines, "\n"), lines: lines})
+		} // for p
+		sort.SliceStable(decls, func(i, j int) bool {
+			return decls[i].key < decls[j].key
+		})
+		for _, d := range decls {
+			fmt.Fprintln(w)
+			for _, line := range d.lines {
+				fmt.Fprintln(w, line)
+			} // for line
+		} // for d
+	} // for frag
+	return nil
+}
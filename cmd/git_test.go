@@ -0,0 +1,179 @@
+package godiff
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+// TestMain runs the test binary as a GIT_EXTERNAL_DIFF program when asked by
+// TestExecGit_Repo.
+func TestMain(m *testing.M) {
+	if os.Getenv("GO_DIFF_TEST_GIT_HELPER") == "1" {
+		if _, err := ExecGit(os.Args[1:], os.Stdout, Options{NoColor: true}); err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(2)
+		} // if
+		os.Exit(0)
+	} // if
+	os.Exit(m.Run())
+}
+
+func TestIsGitArgs(t *testing.T) {
+	assert.Equal(t, "modified", IsGitArgs([]string{"a.go", "/tmp/a", "1234", "100644", "a.go", "5678", "100755"}), true)
+	assert.Equal(t, "added", IsGitArgs([]string{"a.go", "/dev/null", ".", ".", "a.go", "5678", "100644"}), true)
+	assert.Equal(t, "files", IsGitArgs([]string{"a.go", "b.go"}), false)
+}
+
+func TestExecGit_Unmerged(t *testing.T) {
+	var buf bytesp.Slice
+	differ, err := ExecGit([]string{"a.go"}, &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "differ", differ, false)
+	assert.StringEqual(t, "out", string(buf), "* Unmerged path a.go\n")
+}
+
+func TestExecGit_Repo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "go-diff-git")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+			"GIT_EXTERNAL_DIFF="+os.Args[0], "GO_DIFF_TEST_GIT_HELPER=1")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return string(out)
+	}
+	write := func(fn, src string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, fn), []byte(src), 0644))
+	}
+
+	git("init", "-q")
+	write("a.go", "package main\n\nfunc a() {}\n")
+	write("b.txt", "hello\nworld\n")
+	write("c.go", "package main\n\nfunc c() {\n\tprintln(1)\n\tprintln(2)\n\tprintln(3)\n}\n")
+	write("d.txt", "removed\n")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+
+	write("a.go", "package main\n\nfunc b() {}\n\nfunc a() {}\n")
+	write("b.txt", "hello\ngit\n")
+	assert.NoError(t, os.Rename(filepath.Join(dir, "c.go"), filepath.Join(dir, "e.go")))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "d.txt")))
+	assert.NoError(t, os.Chmod(filepath.Join(dir, "a.go"), 0755))
+	git("add", "-A")
+
+	out := git("diff", "--cached", "-M", "--ext-diff")
+	t.Logf("%s", out)
+	for _, exp := range []string{
+		"diff --git a/a.go b/a.go\nold mode 100644\nnew mode 100755\n",
+		"### func b() { ... } (2 lines)",
+		"diff --git a/b.txt b/b.txt\n",
+		"--- world\n+++ git\n",
+		"diff --git a/c.go b/e.go\nsimilarity index 100%\nrename from c.go\nrename to e.go\n",
+		"diff --git a/d.txt b/d.txt\ndeleted file mode 100644\nindex 2c3f0b3..0000000\n",
+		"--- removed\n",
+	} {
+		assert.Equal(t, exp, strings.Contains(out, exp), true)
+	} // for exp
+	assert.Equal(t, "semantic diff", strings.Contains(out, "func a"), false)
+}
+
+func TestTextconv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-textconv")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "a.go")
+	assert.NoError(t, ioutil.WriteFile(fn, []byte(`package main
+
+import "fmt"
+
+func b() { fmt.Println() }
+
+type T int
+
+func a() {}
+`), 0644))
+
+	var buf bytesp.Slice
+	assert.NoError(t, Textconv(&buf, fn))
+	assert.StringEqual(t, "textconv", string(buf), `package main
+import "fmt"
+
+type T int
+
+func a() {
+}
+
+func b() {
+    fmt.Println()
+}
+`)
+}
+
+func TestExecGit_Colors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-git-colors")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	defer func() { gOptions = Options{} }()
+	for _, env := range []string{"GIT_PAGER_IN_USE", "NO_COLOR", "FORCE_COLOR"} {
+		defer os.Setenv(env, os.Getenv(env))
+		os.Setenv(env, "")
+	} // for env
+
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("package main\n\nvar a = 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("package main\n\nvar a = 2\n"), 0644))
+	args := []string{"a.go", a, "1234", "100644", b, "5678", "100644"}
+
+	// Redirected output of git is plain.
+	var buf bytesp.Slice
+	_, err = ExecGit(args, &buf, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", strings.Contains(string(buf), "\x1b"), false)
+
+	// Colors through git's pager are written into w.
+	os.Setenv("GIT_PAGER_IN_USE", "true")
+	buf = nil
+	_, err = ExecGit(args, &buf, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "colored", strings.Contains(string(buf), "\x1b[0;31m--- "), true)
+}
+
+func TestDiffSource_DevNull(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	src := []byte("package main\n\nimport \"fmt\"\n\nfunc a() {}\n")
+	var buf bytesp.Slice
+	differ, err := DiffSource("/dev/null", nil, "a.go", src, &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "added differ", differ, true)
+	assert.StringEqual(t, "added", string(buf), "+++ import \"fmt\"\n### func a() { ... } (2 lines)\n")
+
+	buf = nil
+	differ, err = DiffSource("a.go", src, "/dev/null", nil, &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "deleted differ", differ, true)
+	assert.StringEqual(t, "deleted", string(buf), "--- import \"fmt\"\n=== func a() { ... } (2 lines)\n")
+}
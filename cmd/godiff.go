@@ -17,7 +17,9 @@ import (
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"io"
+	"io/ioutil"
 	"math"
 	"os"
 	"sort"
@@ -39,20 +41,18 @@ func cat(a, sep, b string) string {
 	return a + b
 }
 
-func changeColor(fg ct.Color, fgBright bool, bg ct.Color, bgBright bool) {
+func resetColor() {
 	if gOptions.NoColor {
 		return
 	}
 
-	ct.ChangeColor(fg, fgBright, bg, bgBright)
-}
-
-func resetColor() {
-	if gOptions.NoColor {
+	if gANSI {
+		fmt.Fprint(gOut, ansiReset)
 		return
 	}
-
-	ct.ResetColor()
+	if consoleColors() {
+		ct.ResetColor()
+	} // if
 }
 
 func greedyMatch(lenA, lenB int, diffF func(iA, iB int) int, delCost, insCost func(int) int) (diffMat villa.IntMatrix, cost int, matA, matB []int) {
@@ -191,6 +191,8 @@ type diffFragment interface {
 type fragment struct {
 	tp    int
 	Parts []diffFragment
+	// node is the ast node of a top level declaration, nil otherwise.
+	node ast.Node
 }
 
 func (f *fragment) Type() int {
@@ -555,11 +557,22 @@ func newTypeStmtInfo(fs *token.FileSet, name string, def ast.Expr) *fragment {
 
 func newExpDef(fs *token.FileSet, def ast.Expr) diffFragment {
 	//ast.Print(fs, def)
+	if normalizing() {
+		def = normalizeExpr(def)
+	}
 	var src bytes.Buffer
 	(&printer.Config{Mode: printer.UseSpaces, Tabwidth: 4}).Fprint(&src, fs, def)
 	return &stringFrag{weight: 100, source: src.String()}
 }
 
+func newConstDecl(fs *token.FileSet, d *ast.GenDecl) *fragment {
+	return &fragment{tp: df_CONST, Parts: newVarSpecs(fs, d.Specs), node: d}
+}
+
+func newVarDecl(fs *token.FileSet, spec *ast.ValueSpec) *fragment {
+	return &fragment{tp: df_VAR, Parts: newVarSpecs(fs, []ast.Spec{spec}), node: spec}
+}
+
 func newVarSpecs(fs *token.FileSet, specs []ast.Spec) (dfs []diffFragment) {
 	for _, spec := range specs {
 		f := &fragment{tp: df_VAR_LINE}
@@ -597,6 +610,12 @@ func printToLines(fs *token.FileSet, node interface{}) []string {
 }
 
 func nodeToLines(fs *token.FileSet, node interface{}) (lines []string) {
+	if e, ok := node.(ast.Expr); ok && normalizing() {
+		gInNormalized = true
+		defer func() { gInNormalized = false }()
+		node = normalizeExpr(e)
+	}
+
 	switch nd := node.(type) {
 	case *ast.IfStmt:
 		lines = append(lines, "if")
@@ -765,7 +784,11 @@ func nodeToLines(fs *token.FileSet, node interface{}) (lines []string) {
 		lines = appendLines(lines, ": ", nodeToLines(fs, nd.Value)...)
 	case *ast.FuncLit:
 		lines = nodeToLines(fs, nd.Type)
+		// the body was not visited by normalizeExpr
+		inNormalized := gInNormalized
+		gInNormalized = false
 		lines = appendLines(lines, " ", nodeToLines(fs, nd.Body)...)
+		gInNormalized = inNormalized
 
 	case *ast.CaseClause:
 		if nd.List == nil {
@@ -824,7 +847,7 @@ func newBlockDecl(fs *token.FileSet, blk *ast.BlockStmt) (f *fragment) {
 }
 
 func newFuncDecl(fs *token.FileSet, d *ast.FuncDecl) (f *fragment) {
-	f = &fragment{tp: df_FUNC}
+	f = &fragment{tp: df_FUNC, node: d}
 
 	// recv
 	if d.Recv != nil {
@@ -861,17 +884,32 @@ func newFuncDecl(fs *token.FileSet, d *ast.FuncDecl) (f *fragment) {
 }
 
 type fileInfo struct {
-	f     *ast.File
-	fs    *token.FileSet
-	types *fragment
-	vars  *fragment
-	funcs *fragment
+	f      *ast.File
+	fs     *token.FileSet
+	types  *fragment
+	vars   *fragment
+	funcs  *fragment
+	consts *constDefs
+	// typesInfo is nil if the file is not type-checked.
+	typesInfo *types.Info
+	// calls is nil if the call graph is not built.
+	calls callGraph
+	// ignored is the number of declarations skipped by the ignore rules.
+	ignored int
+	// parseErr is the error of a partial parse, and badDecls is the number of
+	// declarations dropped for it.
+	parseErr error
+	badDecls int
 }
 
 func (info *fileInfo) collect() {
 	info.types = &fragment{}
 	info.vars = &fragment{}
 	info.funcs = &fragment{}
+	info.consts = collectConsts(info.f)
+	if gOptions.TypeCheck && info.fs != nil {
+		info.typesInfo = typeCheck(info.fs, info.f)
+	} // if
 
 	for _, decl := range info.f.Decls {
 		switch d := decl.(type) {
@@ -882,18 +920,25 @@ func (info *fileInfo) collect() {
 					spec := d.Specs[i].(*ast.TypeSpec)
 					//ast.Print(info.fs, spec)
 					ti := newTypeStmtInfo(info.fs, spec.Name.String(), spec.Type)
+					ti.node = spec
 					info.types.Parts = append(info.types.Parts, ti)
 				} // for i
 			case token.CONST:
 				// fmt.Println(d)
 				//ast.Print(info.fs, d)
-				v := &fragment{tp: df_CONST, Parts: newVarSpecs(info.fs, d.Specs)}
-				info.vars.Parts = append(info.vars.Parts, v)
+				if gOptions.FoldConsts {
+					info.vars.Parts = append(info.vars.Parts, newFoldedConstDecl(info.fs, info.consts, d))
+				} else {
+					info.vars.Parts = append(info.vars.Parts, newConstDecl(info.fs, d))
+				} // else
 			case token.VAR:
 				//ast.Print(info.fs, d)
-				vss := newVarSpecs(info.fs, d.Specs)
-				for _, vs := range vss {
-					info.vars.Parts = append(info.vars.Parts, &fragment{tp: df_VAR, Parts: []diffFragment{vs}})
+				for _, spec := range d.Specs {
+					if gOptions.FoldConsts {
+						info.vars.Parts = append(info.vars.Parts, newFoldedVarDecl(info.fs, info.consts, spec.(*ast.ValueSpec)))
+					} else {
+						info.vars.Parts = append(info.vars.Parts, newVarDecl(info.fs, spec.(*ast.ValueSpec)))
+					} // else
 				}
 			case token.IMPORT:
 				// ignore
@@ -909,53 +954,80 @@ func (info *fileInfo) collect() {
 			// fmt.Println(d)
 		} // switch decl.(type)
 	} // for decl
+
+	info.filterIgnored()
+	if gOptions.CallGraph {
+		info.calls = buildCallGraph(info)
+	} // if
 }
 
 func parse(fn string, src interface{}) (*fileInfo, error) {
 	if fn == "/dev/null" {
-		return &fileInfo{
-			f:     &ast.File{},
-			types: &fragment{},
-			vars:  &fragment{},
-			funcs: &fragment{},
-		}, nil
+		info := &fileInfo{f: &ast.File{}}
+		info.collect()
+		return info, nil
 	}
 
+	var mode parser.Mode
+	if gOptions.Partial {
+		mode = parser.AllErrors
+	} // if
+	if gOptions.IgnoreGenerated {
+		// for the "Code generated" comment
+		mode |= parser.ParseComments
+	} // if
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, fn, src, 0)
-	if err != nil {
+	f, err := parser.ParseFile(fset, fn, src, mode)
+	if err != nil && (!gOptions.Partial || f == nil) {
 		return nil, err
 	} // if
 
 	info := &fileInfo{f: f, fs: fset}
+	if err != nil {
+		info.parseErr, info.badDecls = err, dropBadDecls(fset, f, err)
+	} // if
 	info.collect()
 
 	return info, nil
 }
 
-const (
-	// delete color
-	del_COLOR = ct.Red
-	// insert color
-	ins_COLOR = ct.Green
-	// matched color
-	mat_COLOR = ct.White
-	// folded color
-	fld_COLOR = ct.Yellow
-)
-
 func showDelWholeLine(line string) {
-	changeColor(del_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_DEL)
 	fmt.Fprintln(gOut, "===", line)
 	resetColor()
 }
+func showEquivLine(line string) {
+	setStyle(st_FLD)
+	fmt.Fprintln(gOut, "~~~", line, "(semantically equivalent)")
+	resetColor()
+}
+func showWarnLine(line string) {
+	gDiffs++
+	setStyle(st_WARN)
+	fmt.Fprintln(gOut, "!!!", line)
+	resetColor()
+}
+func showNoteLine(line string) {
+	setStyle(st_FLD)
+	fmt.Fprintln(gOut, ":::", line)
+	resetColor()
+}
+func showMovedLine(line string) {
+	gDiffs++
+	setStyle(st_FLD)
+	fmt.Fprintln(gOut, ">>>", line)
+	resetColor()
+}
 func showDelLine(line string) {
-	changeColor(del_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_DEL)
 	fmt.Fprintln(gOut, "---", line)
 	resetColor()
 }
 func showColorDelLine(line, lcs string) {
-	changeColor(del_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_DEL)
 	fmt.Fprint(gOut, "--- ")
 	lcsr := []rune(lcs)
 	for _, c := range line {
@@ -963,7 +1035,7 @@ func showColorDelLine(line, lcs string) {
 			resetColor()
 			lcsr = lcsr[1:]
 		} else {
-			changeColor(del_COLOR, false, ct.None, false)
+			setStyle(st_DEL_TOKEN)
 		} // else
 		fmt.Fprintf(gOut, "%c", c)
 	} // for c
@@ -972,8 +1044,56 @@ func showColorDelLine(line, lcs string) {
 	fmt.Fprintln(gOut)
 }
 
+// contextLines returns the number of unchanged lines shown before and after
+// changed ones.
+func contextLines() int {
+	if gOptions.Context < 0 {
+		return 0
+	} // if
+	if gOptions.Context == 0 {
+		return 1
+	} // if
+	return gOptions.Context
+}
+
+// foldGap returns the number of lines shown at each end of an added or
+// deleted declaration.
+func foldGap() int {
+	if gOptions.FoldAdded < 0 {
+		return 0
+	} // if
+	if gOptions.FoldAdded == 0 {
+		return 2
+	} // if
+	return gOptions.FoldAdded
+}
+
+// showDelPart shows a deleted type or function as one line, or in full with
+// FullText.
+func showDelPart(f diffFragment) {
+	if !gOptions.FullText {
+		showDelWholeLine(f.oneLine())
+		return
+	} // if
+	for _, line := range f.sourceLines("") {
+		showDelLine(line)
+	} // for line
+}
+
+// showInsPart shows an inserted type or function as one line, or in full
+// with FullText.
+func showInsPart(f diffFragment) {
+	if !gOptions.FullText {
+		showInsWholeLine(f.oneLine())
+		return
+	} // if
+	for _, line := range f.sourceLines("") {
+		showInsLine(line)
+	} // for line
+}
+
 func showDelLines(lines []string, gapLines int) {
-	if len(lines) <= gapLines*2+1 {
+	if gOptions.NoFold || len(lines) <= gapLines*2+1 {
 		for _, line := range lines {
 			showDelLine(line)
 		} // for line
@@ -991,12 +1111,14 @@ func showDelLines(lines []string, gapLines int) {
 }
 
 func showInsLine(line string) {
-	changeColor(ins_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_INS)
 	fmt.Fprintln(gOut, "+++", line)
 	resetColor()
 }
 func showColorInsLine(line, lcs string) {
-	changeColor(ins_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_INS)
 	fmt.Fprint(gOut, "+++ ")
 	lcsr := []rune(lcs)
 	for _, c := range line {
@@ -1004,7 +1126,7 @@ func showColorInsLine(line, lcs string) {
 			resetColor()
 			lcsr = lcsr[1:]
 		} else {
-			changeColor(ins_COLOR, false, ct.None, false)
+			setStyle(st_INS_TOKEN)
 		} // else
 		fmt.Fprintf(gOut, "%c", c)
 	} // for c
@@ -1014,13 +1136,14 @@ func showColorInsLine(line, lcs string) {
 }
 
 func showInsWholeLine(line string) {
-	changeColor(ins_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_INS)
 	fmt.Fprintln(gOut, "###", line)
 	resetColor()
 }
 
 func showInsLines(lines []string, gapLines int) {
-	if len(lines) <= gapLines*2+1 {
+	if gOptions.NoFold || len(lines) <= gapLines*2+1 {
 		for _, line := range lines {
 			showInsLine(line)
 		} // for line
@@ -1038,14 +1161,15 @@ func showInsLines(lines []string, gapLines int) {
 }
 
 func showDelTokens(del []string, mat []int, ins []string) {
-	changeColor(del_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_DEL)
 	fmt.Fprint(gOut, "--- ")
 
 	for i, tk := range del {
 		if mat[i] < 0 || tk != ins[mat[i]] {
-			changeColor(del_COLOR, false, ct.None, false)
+			setStyle(st_DEL_TOKEN)
 		} else {
-			changeColor(mat_COLOR, false, ct.None, false)
+			setStyle(st_MAT)
 		}
 
 		fmt.Fprint(gOut, tk)
@@ -1056,12 +1180,13 @@ func showDelTokens(del []string, mat []int, ins []string) {
 }
 
 func showInsTokens(ins []string, mat []int, del []string) {
-	changeColor(ins_COLOR, false, ct.None, false)
+	gDiffs++
+	setStyle(st_INS)
 	fmt.Fprint(gOut, "+++ ")
 
 	for i, tk := range ins {
 		if mat[i] < 0 || tk != del[mat[i]] {
-			changeColor(ins_COLOR, false, ct.None, false)
+			setStyle(st_INS_TOKEN)
 		} else {
 			resetColor()
 		} // else
@@ -1117,43 +1242,76 @@ type lineOutputer interface {
 
 type lineOutput struct {
 	sameLines []string
+	// tags of the changed lines in current hunk
+	tags []string
 }
 
 func (lo *lineOutput) outputIns(line string) {
-	lo.end()
+	lo.showSame()
 	showInsLine(line)
+	lo.tag(line)
 }
 
 func (lo *lineOutput) outputDel(line string) {
-	lo.end()
+	lo.showSame()
 	showDelLine(line)
+	lo.tag(line)
 }
 
 func (lo *lineOutput) outputChange(del, ins string) {
-	lo.end()
+	lo.showSame()
 	showDiffLine(del, ins)
+	lo.tag(del)
+	lo.tag(ins)
 }
 
 func (lo *lineOutput) outputSame(line string) {
+	lo.showTags()
 	lo.sameLines = append(lo.sameLines, line)
 }
 
+func (lo *lineOutput) tag(line string) {
+	if !gOptions.Concurrency {
+		return
+	} // if
+	lo.tags = appendUnique(lo.tags, concurrencyTags(line)...)
+}
+
+// showTags shows the concurrency tags of current hunk, if any.
+func (lo *lineOutput) showTags() {
+	if len(lo.tags) > 0 {
+		showWarnLine("concurrency: " + strings.Join(lo.tags, ", "))
+		lo.tags = nil
+	} // if
+}
+
 func (lo *lineOutput) end() {
-	if len(lo.sameLines) > 0 {
-		fmt.Fprintln(gOut, "   ", lo.sameLines[0])
-		if len(lo.sameLines) == 3 {
-			fmt.Fprintln(gOut, "   ", lo.sameLines[1])
-		} // if
-		if len(lo.sameLines) > 3 {
-			changeColor(fld_COLOR, false, ct.None, false)
-			fmtp.Fprintfln(gOut, "        ... (%d lines)", len(lo.sameLines)-2)
-			resetColor()
-		} // if
-		if len(lo.sameLines) > 1 {
-			fmt.Fprintln(gOut, "   ", lo.sameLines[len(lo.sameLines)-1])
-		} // if
+	lo.showTags()
+	lo.showSame()
+}
+
+// showSame shows the pending same lines, folded unless gOptions.NoFold.
+func (lo *lineOutput) showSame() {
+	if gOptions.NoFold {
+		for _, line := range lo.sameLines {
+			fmt.Fprintln(gOut, "   ", line)
+		} // for line
+		lo.sameLines = nil
+		return
 	} // if
 
+	// With no context, even a single line is folded.
+	n := contextLines()
+	for i, line := range lo.sameLines {
+		if n > 0 && len(lo.sameLines) <= n*2+1 || i < n || i >= len(lo.sameLines)-n {
+			fmt.Fprintln(gOut, "   ", line)
+		} else if i == n {
+			setStyle(st_FLD)
+			fmtp.Fprintfln(gOut, "        ... (%d lines)", len(lo.sameLines)-n*2)
+			resetColor()
+		} // else if
+	} // for i, line
+
 	lo.sameLines = nil
 }
 
@@ -1272,6 +1430,10 @@ func diffLines(orgLines, newLines []string, format string) int {
    Diff Package
 */
 func diffPackage(orgInfo, newInfo *fileInfo) {
+	if orgInfo.f.Name == nil || newInfo.f.Name == nil {
+		// an added or deleted file, i.e. /dev/null
+		return
+	} // if
 	orgName := orgInfo.f.Name.String()
 	newName := newInfo.f.Name.String()
 	if orgName != newName {
@@ -1298,165 +1460,430 @@ func diffImports(orgInfo, newInfo *fileInfo) {
 	diffLineSet(orgImports, newImports, `import %s`)
 }
 
+// matchParts matches top level fragments of two files.
+func matchParts(orgParts, newParts []diffFragment) (mat villa.IntMatrix, matA, matB []int) {
+	mat, _, matA, matB = greedyMatch(len(orgParts), len(newParts), func(iA, iB int) int {
+		return orgParts[iA].calcDiff(newParts[iB]) * 3 / 2
+	}, func(iA int) int {
+		return orgParts[iA].Weight()
+	}, func(iB int) int {
+		return newParts[iB].Weight()
+	})
+	return mat, matA, matB
+}
+
 /*
    Diff Types
 */
 func diffTypes(orgInfo, newInfo *fileInfo) {
-	mat, _, matA, matB := greedyMatch(len(orgInfo.types.Parts), len(newInfo.types.Parts), func(iA, iB int) int {
-		return orgInfo.types.Parts[iA].calcDiff(newInfo.types.Parts[iB]) * 3 / 2
-	}, func(iA int) int {
-		return orgInfo.types.Parts[iA].Weight()
-	}, func(iB int) int {
-		return newInfo.types.Parts[iB].Weight()
-	})
+	mat, matA, matB := matchParts(orgInfo.types.Parts, newInfo.types.Parts)
 
 	j0 := 0
 	for i := range matA {
 		j := matA[i]
 		if j < 0 {
-			showDelWholeLine(orgInfo.types.Parts[i].oneLine())
+			if selected(orgInfo, orgInfo.types.Parts[i]) {
+				showDelPart(orgInfo.types.Parts[i])
+			} // if
 		} else {
 			for ; j0 < j; j0++ {
-				if matB[j0] < 0 {
-					showInsWholeLine(newInfo.types.Parts[j0].oneLine())
+				if matB[j0] < 0 && selected(newInfo, newInfo.types.Parts[j0]) {
+					showInsPart(newInfo.types.Parts[j0])
 				}
 			}
+			if !selectedPair(orgInfo, orgInfo.types.Parts[i], newInfo, newInfo.types.Parts[j]) {
+				continue
+			} // if
 
 			if mat[i][j] > 0 {
 				orgInfo.types.Parts[i].showDiff(newInfo.types.Parts[j])
+				if gOptions.TypeCheck {
+					annotateTypes(orgInfo, orgInfo.types.Parts[i], newInfo, newInfo.types.Parts[j])
+				} // if
 			} //  if
 		} // else
 	} // for i
 
 	for ; j0 < len(matB); j0++ {
-		if matB[j0] < 0 {
-			showInsWholeLine(newInfo.types.Parts[j0].oneLine())
+		if matB[j0] < 0 && selected(newInfo, newInfo.types.Parts[j0]) {
+			showInsPart(newInfo.types.Parts[j0])
 		}
 	}
+
+	if gOptions.Ordered {
+		showMoves(orgInfo, orgInfo.types.Parts, newInfo, newInfo.types.Parts, matA)
+	} // if
 }
 
 func diffVars(orgInfo, newInfo *fileInfo) {
-	mat, _, matA, matB := greedyMatch(len(orgInfo.vars.Parts), len(newInfo.vars.Parts), func(iA, iB int) int {
-		return orgInfo.vars.Parts[iA].calcDiff(newInfo.vars.Parts[iB]) * 3 / 2
-	}, func(iA int) int {
-		return orgInfo.vars.Parts[iA].Weight()
-	}, func(iB int) int {
-		return newInfo.vars.Parts[iB].Weight()
-	})
+	mat, matA, matB := matchParts(orgInfo.vars.Parts, newInfo.vars.Parts)
 
 	j0 := 0
 	for i := range matA {
 		j := matA[i]
 		if j < 0 {
-			showDelLines(orgInfo.vars.Parts[i].sourceLines(""), 2)
+			if !selected(orgInfo, orgInfo.vars.Parts[i]) {
+				continue
+			} // if
+			showDelLines(orgInfo.vars.Parts[i].sourceLines(""), foldGap())
 			// fmt.Println()
 		} else {
 			for ; j0 < j; j0++ {
-				if matB[j0] < 0 {
-					showInsLines(newInfo.vars.Parts[j0].sourceLines(""), 2)
+				if matB[j0] < 0 && selected(newInfo, newInfo.vars.Parts[j0]) {
+					showInsLines(newInfo.vars.Parts[j0].sourceLines(""), foldGap())
 				} // if
 			}
+			if !selectedPair(orgInfo, orgInfo.vars.Parts[i], newInfo, newInfo.vars.Parts[j]) {
+				continue
+			} // if
 
 			if mat[i][j] > 0 {
 				orgInfo.vars.Parts[i].showDiff(newInfo.vars.Parts[j])
+				if gOptions.FoldConsts {
+					annotateFoldedVars(orgInfo, orgInfo.vars.Parts[i], newInfo, newInfo.vars.Parts[j])
+				} // if
+				if gOptions.TypeCheck {
+					annotateTypes(orgInfo, orgInfo.vars.Parts[i], newInfo, newInfo.vars.Parts[j])
+				} // if
 				fmt.Fprintln(gOut)
-			} //  if
+			} else if gOptions.Normalize && !sameRawSource(orgInfo, orgInfo.vars.Parts[i], newInfo, newInfo.vars.Parts[j]) {
+				showEquivLine(newInfo.vars.Parts[j].oneLine())
+			} // else if
 		} // else
 	} // for i
 
 	for ; j0 < len(matB); j0++ {
-		if matB[j0] < 0 {
-			showInsLines(newInfo.vars.Parts[j0].sourceLines(""), 2)
+		if matB[j0] < 0 && selected(newInfo, newInfo.vars.Parts[j0]) {
+			showInsLines(newInfo.vars.Parts[j0].sourceLines(""), foldGap())
 		} // if
 	}
+	if gOptions.FoldConsts {
+		annotateUnmatchedVars(orgInfo, orgInfo.vars.Parts, newInfo, newInfo.vars.Parts, matA, matB)
+	} // if
+
+	if gOptions.Ordered {
+		showMoves(orgInfo, orgInfo.vars.Parts, newInfo, newInfo.vars.Parts, matA)
+	} // if
 }
 
 func diffFuncs(orgInfo, newInfo *fileInfo) {
-	mat, _, matA, matB := greedyMatch(len(orgInfo.funcs.Parts), len(newInfo.funcs.Parts), func(iA, iB int) int {
-		return orgInfo.funcs.Parts[iA].calcDiff(newInfo.funcs.Parts[iB]) * 3 / 2
-	}, func(iA int) int {
-		return orgInfo.funcs.Parts[iA].Weight()
-	}, func(iB int) int {
-		return newInfo.funcs.Parts[iB].Weight()
-	})
+	mat, matA, matB := matchParts(orgInfo.funcs.Parts, newInfo.funcs.Parts)
 
 	j0 := 0
 	for i := range matA {
 		j := matA[i]
 		if j < 0 {
-			showDelWholeLine(orgInfo.funcs.Parts[i].oneLine())
+			if selected(orgInfo, orgInfo.funcs.Parts[i]) {
+				showDelPart(orgInfo.funcs.Parts[i])
+				if gOptions.CallGraph {
+					annotateDeletedCalls(orgInfo, orgInfo.funcs.Parts[i])
+				} // if
+			} // if
 		} else {
 			for ; j0 < j; j0++ {
-				if matB[j0] < 0 {
-					showInsWholeLine(newInfo.funcs.Parts[j0].oneLine())
+				if matB[j0] < 0 && selected(newInfo, newInfo.funcs.Parts[j0]) {
+					showInsPart(newInfo.funcs.Parts[j0])
+					if gOptions.Concurrency {
+						annotateLocks(nil, newInfo.funcs.Parts[j0])
+					} // if
 				}
 			}
+			if !selectedPair(orgInfo, orgInfo.funcs.Parts[i], newInfo, newInfo.funcs.Parts[j]) {
+				continue
+			} // if
 			if mat[i][j] > 0 {
 				orgInfo.funcs.Parts[i].showDiff(newInfo.funcs.Parts[j])
-			} //  if
+				if gOptions.TypeCheck {
+					annotateTypes(orgInfo, orgInfo.funcs.Parts[i], newInfo, newInfo.funcs.Parts[j])
+				} // if
+				if gOptions.CallGraph {
+					annotateCalls(orgInfo, orgInfo.funcs.Parts[i], newInfo, newInfo.funcs.Parts[j])
+				} // if
+				if gOptions.Metrics {
+					annotateMetrics(orgInfo.funcs.Parts[i], newInfo.funcs.Parts[j])
+				} // if
+				if gOptions.ErrCheck {
+					annotateErrHandling(orgInfo.funcs.Parts[i], newInfo.funcs.Parts[j])
+				} // if
+				if gOptions.Concurrency {
+					annotateLocks(orgInfo.funcs.Parts[i], newInfo.funcs.Parts[j])
+				} // if
+			} else if gOptions.Normalize && !sameRawSource(orgInfo, orgInfo.funcs.Parts[i], newInfo, newInfo.funcs.Parts[j]) {
+				showEquivLine(newInfo.funcs.Parts[j].oneLine())
+			} // else if
 		} // else
 	} // for i
 
 	for ; j0 < len(matB); j0++ {
-		if matB[j0] < 0 {
-			showInsWholeLine(newInfo.funcs.Parts[j0].oneLine())
+		if matB[j0] < 0 && selected(newInfo, newInfo.funcs.Parts[j0]) {
+			showInsPart(newInfo.funcs.Parts[j0])
+			if gOptions.Concurrency {
+				annotateLocks(nil, newInfo.funcs.Parts[j0])
+			} // if
 		}
 	}
+
+	if gOptions.Ordered {
+		showMoves(orgInfo, orgInfo.funcs.Parts, newInfo, newInfo.funcs.Parts, matA)
+	} // if
+}
+
+func declLine(info *fileInfo, f diffFragment) int {
+	nd := f.(*fragment).node
+	if nd == nil || info.fs == nil {
+		return 0
+	} // if
+	return info.fs.Position(nd.Pos()).Line
+}
+
+/*
+   Shows matched declarations whose relative order changed. The longest
+   sequence of matched declarations keeping their order stays, all others are
+   considered as moved.
+*/
+func showMoves(orgInfo *fileInfo, orgParts []diffFragment, newInfo *fileInfo, newParts []diffFragment, matA []int) {
+	var is []int
+	for i, j := range matA {
+		if j >= 0 {
+			is = append(is, i)
+		} // if
+	} // for i, j
+
+	// lens[k] is the length of the longest increasing subsequence ending at is[k]
+	lens, prevs := make([]int, len(is)), make([]int, len(is))
+	best := -1
+	for k := range is {
+		lens[k], prevs[k] = 1, -1
+		for l := 0; l < k; l++ {
+			if matA[is[l]] < matA[is[k]] && lens[l]+1 > lens[k] {
+				lens[k], prevs[k] = lens[l]+1, l
+			} // if
+		} // for l
+		if best < 0 || lens[k] > lens[best] {
+			best = k
+		} // if
+	} // for k
+
+	kept := make([]bool, len(is))
+	for k := best; k >= 0; k = prevs[k] {
+		kept[k] = true
+	} // for k
+
+	for k, i := range is {
+		if !kept[k] && selectedPair(orgInfo, orgParts[i], newInfo, newParts[matA[i]]) {
+			j := matA[i]
+			showMovedLine(fmt.Sprintf("%s (moved from line %d to line %d)", newParts[j].oneLine(),
+				declLine(orgInfo, orgParts[i]), declLine(newInfo, newParts[j])))
+		} // if
+	} // for k, i
 }
 
 func diff(orgInfo, newInfo *fileInfo) {
-	diffPackage(orgInfo, newInfo)
-	diffImports(orgInfo, newInfo)
+	if gOptions.API {
+		diffAPI(orgInfo, newInfo)
+		return
+	} // if
+	if gOptions.Symbols {
+		diffSymbols(orgInfo, newInfo)
+		return
+	} // if
+	if gOptions.Stat {
+		diffStat(orgInfo, newInfo)
+		return
+	} // if
+
+	if len(gOptions.Only) == 0 {
+		diffPackage(orgInfo, newInfo)
+		diffImports(orgInfo, newInfo)
+	} // if
 	diffTypes(orgInfo, newInfo)
 	diffVars(orgInfo, newInfo)
+	diffConstValues(orgInfo, newInfo)
 	diffFuncs(orgInfo, newInfo)
+	showIgnored(orgInfo, newInfo)
+	showBadDecls(orgInfo, newInfo)
 }
 
-func readLines(fn villa.Path) []string {
-	bts, err := fn.ReadFile()
-
-	if err != nil {
-		return nil
+// readSource reads the source of a file, or stdin if fn is "-".
+func readSource(fn string) ([]byte, error) {
+	switch fn {
+	case "-":
+		return ioutil.ReadAll(os.Stdin)
+	case "/dev/null":
+		return nil, nil
 	}
+	return villa.Path(fn).ReadFile()
+}
 
-	return strings.Split(string(bts), "\n")
+// checkStdin returns an error if more than one of the file names is "-", since
+// stdin can only be read once.
+func checkStdin(fns ...string) error {
+	cnt := 0
+	for _, fn := range fns {
+		if fn == "-" {
+			cnt++
+		} // if
+	} // for fn
+	if cnt > 1 {
+		return fmt.Errorf("stdin (-) can be read for only one file")
+	} // if
+	return nil
 }
 
 // Options specifies options for processing files.
 type Options struct {
-	NoColor bool // Turn off the colors when printing.
+	NoColor   bool // Turn off the colors when printing.
+	Normalize bool // Canonicalize commutative and trivial expressions before comparing.
+	Ordered   bool // Report reordered global declarations as moved.
+	// Compare the evaluated values of constant expressions instead of the
+	// sources, e.g. 1 << 10 equals to 1024.
+	FoldConsts bool
+	// Type-check both files and annotate changes with resolved types.
+	TypeCheck bool
+	// Show only the changes of exported declarations classified as compatible
+	// or incompatible, and the suggested semantic version bump.
+	API bool
+	// Print only the qualified names of changed declarations, e.g.
+	// pkg.Type.Method.
+	Symbols bool
+	// With Symbols, also print the functions calling or referencing changed
+	// declarations, transitively.
+	SymbolCallers bool
+	// Annotate changed functions with their callers and changed call edges.
+	CallGraph bool
+	// Annotate changed functions with complexity and size metrics.
+	Metrics bool
+	// Print only the numbers of changed declarations and the biggest
+	// complexity increases.
+	Stat bool
+	// Warn about changed error handling in functions, e.g. removed checks.
+	ErrCheck bool
+	// Tag changes touching concurrency constructs, and warn about added locks
+	// without matching unlocks.
+	Concurrency bool
+
+	IgnoreGenerated  bool     // Ignore files marked "Code generated ... DO NOT EDIT."
+	IgnoreTests      bool     // Ignore _test.go files.
+	IgnoreUnexported bool     // Ignore unexported declarations.
+	IgnoreNames      []string // Ignore declarations whose names match any of the patterns.
+
+	// Treat falling back to the line diff, because parsing failed, as an error.
+	Strict bool
+	// Parse with error recovery and diff the declarations without errors,
+	// instead of falling back to the line diff.
+	Partial bool
+	// Show unchanged lines instead of folding them.
+	NoFold bool
+	// Do not page the output through $PAGER when stdout is a terminal.
+	NoPager bool
+	// Truncate lines longer than the width, marking them with "…", if
+	// positive.
+	Width int
+	// Soft-wrap long lines at Width, or the terminal width if not positive,
+	// instead of truncating them.
+	Wrap bool
+	// The color theme, one of ThemeNames(), "default" if empty.
+	Theme string
+	// The number of colors, 16, 256 or 24 for 24-bit colors. If 0, Exec
+	// detects it from $COLORTERM and $TERM, others use 16.
+	Colors int
+	// The number of unchanged lines shown before and after changed ones, 1 if
+	// 0, none if negative.
+	Context int
+	// The number of lines shown at each end of added or deleted declarations
+	// before folding the rest, 2 if 0, none if negative.
+	FoldAdded int
+	// Show the full text of added or deleted types and functions instead of
+	// one line.
+	FullText bool
+	// Show only the declarations whose names match any of the patterns, e.g.
+	// Server.* or New*. Matching is done before filtering so that renames
+	// into or out of the patterns are still shown.
+	Only []string
 }
 
 var (
 	gOut     io.Writer
 	gOptions Options
+	// gDiffs is the number of differences shown.
+	gDiffs int
+	// gANSI is set to write colors as ANSI sequences into gOut instead of
+	// changing the console colors.
+	gANSI bool
 )
 
-// Exec prints the difference between two Go files to stdout. Not thread-safe.
-func Exec(orgFn, newFn string, options Options) {
-	gOut = os.Stdout
-	gOptions = options
+// Exec prints the difference between two Go files to stdout. A file name of
+// "-" reads the source from stdin. differ is true if any semantic difference
+// is found. Not thread-safe.
+func Exec(orgFn, newFn string, options Options) (differ bool, err error) {
+	if err := checkStdin(orgFn, newFn); err != nil {
+		return false, err
+	} // if
+	orgSrc, err := readSource(orgFn)
+	if err != nil {
+		return false, err
+	} // if
+	newSrc, err := readSource(newFn)
+	if err != nil {
+		return false, err
+	} // if
 
-	fmtp.Printfln("Difference between %s and %s ...", orgFn, newFn)
+	ansi := setupColors(&options, isTerminal(os.Stdout))
+	out, finish := setupOutput(options, ansi)
+	defer finish()
 
-	orgInfo, err1 := parse(orgFn, nil)
-	newInfo, err2 := parse(newFn, nil)
+	fmtp.Fprintfln(out, "Difference between %s and %s ...", orgFn, newFn)
+
+	return DiffSource(orgFn, orgSrc, newFn, newSrc, out, options)
+}
+
+// DiffSource prints the difference between two Go sources into w, with the
+// parse errors, if any. The names are used for positions in messages. Unless
+// set up by an Exec function, colors are shown only if w is stdout. differ is
+// true if any semantic difference is found. Not thread-safe.
+func DiffSource(orgName string, orgSrc []byte, newName string, newSrc []byte, w io.Writer, options Options) (differ bool, err error) {
+	gOut = w
+	gOptions = options
+	gDiffs = 0
+
+	orgInfo, err1 := parse(orgName, orgSrc)
+	newInfo, err2 := parse(newName, newSrc)
 
 	if err1 != nil || err2 != nil {
-		orgLines := readLines(villa.Path(orgFn))
-		newLines := readLines(villa.Path(newFn))
+		if err1 != nil {
+			reportParseErrors(orgName, err1)
+		} // if
+		if err2 != nil {
+			reportParseErrors(newName, err2)
+		} // if
+		if options.Strict {
+			if err1 != nil {
+				return false, err1
+			} // if
+			return false, err2
+		} // if
 
-		diffLines(orgLines, newLines, "%s")
-		return
+		fmtp.Fprintfln(gOut, "go-diff: parsing failed, falling back to line diff")
+		diffLines(strings.Split(string(orgSrc), "\n"), strings.Split(string(newSrc), "\n"), "%s")
+		return gDiffs > 0, nil
 	}
 
+	for _, info := range []*fileInfo{orgInfo, newInfo} {
+		if info.parseErr != nil {
+			reportParseErrors(info.fileName(), info.parseErr)
+		} // if
+	} // for info
+
 	diff(orgInfo, newInfo)
+	return gDiffs > 0, nil
 }
 
-// ExecWriter prints the difference between two parsed Go files into w. Not thread-safe.
-func ExecWriter(w io.Writer, fset0 *token.FileSet, file0 *ast.File, fset1 *token.FileSet, file1 *ast.File, options Options) {
+// ExecWriter prints the difference between two parsed Go files into w. differ
+// is true if any semantic difference is found. Not thread-safe.
+func ExecWriter(w io.Writer, fset0 *token.FileSet, file0 *ast.File, fset1 *token.FileSet, file1 *ast.File, options Options) (differ bool) {
 	gOut = w
 	gOptions = options
+	gDiffs = 0
 
 	orgInfo := &fileInfo{f: file0, fs: fset0}
 	orgInfo.collect()
@@ -1464,4 +1891,5 @@ func ExecWriter(w io.Writer, fset0 *token.FileSet, file0 *ast.File, fset1 *token
 	newInfo.collect()
 
 	diff(orgInfo, newInfo)
+	return gDiffs > 0
 }
@@ -1,6 +1,13 @@
 package godiff
 
 import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -87,3 +94,167 @@ defg`, "\n")
     defg
 `, "\n"))
 }
+
+func TestDiff_Ordered(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{Ordered: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func a() {}
+
+func b() {}
+
+func c() {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func b() {}
+
+func c() {}
+
+func a() {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diff(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", strings.Split(string(buf), "\n"),
+		strings.Split(`>>> func a() { ... } (2 lines) (moved from line 4 to line 8)
+`, "\n"))
+}
+
+func TestExecWriter_Differ(t *testing.T) {
+	parseFile := func(src string) (*token.FileSet, *ast.File) {
+		fs := token.NewFileSet()
+		f, err := parser.ParseFile(fs, "", src, 0)
+		assert.NoError(t, err)
+		return fs, f
+	}
+	fs0, f0 := parseFile("package main\n\nfunc a() {}\n")
+	fs1, f1 := parseFile("package main\n\n// a does nothing.\nfunc a() {}\n")
+	fs2, f2 := parseFile("package main\n\nfunc a() { b() }\n")
+
+	var buf bytesp.Slice
+	assert.Equal(t, "same", ExecWriter(&buf, fs0, f0, fs1, f1, Options{NoColor: true}), false)
+	assert.Equal(t, "changed", ExecWriter(&buf, fs0, f0, fs2, f2, Options{NoColor: true}), true)
+}
+
+func TestExec_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-exec")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	good, bad := filepath.Join(dir, "good.go"), filepath.Join(dir, "bad.go")
+	assert.NoError(t, ioutil.WriteFile(good, []byte("package main\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(bad, []byte("package main\nfunc (\n"), 0644))
+	defer func() { gOptions = Options{} }()
+
+	_, err = Exec(good, filepath.Join(dir, "missing.go"), Options{NoColor: true})
+	assert.Equal(t, "missing file error", err != nil, true)
+
+	_, err = Exec("-", "-", Options{NoColor: true})
+	assert.Equal(t, "two stdin error", err != nil, true)
+
+	differ, err := Exec(good, bad, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "differ", differ, true)
+
+	_, err = Exec(good, bad, Options{NoColor: true, Strict: true})
+	assert.Equal(t, "strict error", err != nil, true)
+
+	differ, err = Exec(good, good, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "same", differ, false)
+}
+
+func TestDiffSource(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	var buf bytesp.Slice
+	differ, err := DiffSource("a.go", []byte("package main\n\nfunc a() {}\n"),
+		"b.go", []byte("package main\n\nfunc a() {}\n\nfunc b() {}\n"), &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "differ", differ, true)
+	assert.StringEqual(t, "diff", string(buf), "### func b() { ... } (2 lines)\n")
+
+	buf = nil
+	differ, err = DiffSource("a.go", []byte("not go\n"), "b.go", []byte("still not go\n"), &buf, Options{NoColor: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "differ", differ, true)
+	assert.StringEqual(t, "diff", string(buf), `go-diff: a.go:1:1: expected 'package', found not
+go-diff: b.go:1:1: expected 'package', found still
+go-diff: parsing failed, falling back to line diff
+--- not go
++++ still not go
+    
+`)
+}
+
+func TestReadSource_Stdin(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-diff-stdin")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.WriteString("package main\n")
+	assert.NoError(t, err)
+	_, err = f.Seek(0, 0)
+	assert.NoError(t, err)
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = stdin }()
+
+	src, err := readSource("-")
+	assert.NoError(t, err)
+	assert.StringEqual(t, "src", string(src), "package main\n")
+}
+
+func TestDiffSource_Context(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	org := "package main\n\nfunc a() {\n\ta1()\n\ta2()\n\ta3()\n\ta4()\n\ta5()\n}\n"
+	nw := "package main\n\nfunc a() {\n\ta1()\n\ta2()\n\ta3()\n\ta4()\n\tb5()\n}\n"
+	for _, c := range []struct {
+		context int
+		exp     string
+	}{
+		{0, "    func a() {\n        ... (3 lines)\n        a4()\n---     a5()\n+++     b5()\n    }\n"},
+		{2, "    func a() {\n        a1()\n        a2()\n        a3()\n        a4()\n---     a5()\n+++     b5()\n    }\n"},
+		{-1, "        ... (5 lines)\n---     a5()\n+++     b5()\n        ... (1 lines)\n"},
+	} {
+		var buf bytesp.Slice
+		_, err := DiffSource("a.go", []byte(org), "b.go", []byte(nw), &buf, Options{NoColor: true, Context: c.context})
+		assert.NoError(t, err)
+		assert.StringEqual(t, fmt.Sprintf("context %d", c.context), string(buf), c.exp)
+	} // for c
+}
+
+func TestDiffSource_FullText(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte("package main\n"),
+		"b.go", []byte("package main\n\nfunc b() {\n\tb1()\n}\n"), &buf, Options{NoColor: true, FullText: true})
+	assert.NoError(t, err)
+	assert.StringEqual(t, "diff", string(buf), "+++ func b() {\n+++     b1()\n+++ }\n")
+
+	buf = nil
+	_, err = DiffSource("a.go", []byte("package main\n"),
+		"b.go", []byte("package main\n\nvar v = []int{\n\t1,\n\t2,\n\t3,\n}\n"), &buf, Options{NoColor: true, FoldAdded: 1})
+	assert.NoError(t, err)
+	assert.StringEqual(t, "fold-added", string(buf), "+++ var v = []int{\n###     ... (3 lines)\n+++         }\n")
+}
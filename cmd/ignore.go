@@ -0,0 +1,182 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated returns true if a comment before the package clause marks the
+// file as generated. The file needs to be parsed with comments, parse does so
+// with IgnoreGenerated.
+func isGenerated(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		if f.Package.IsValid() && cg.Pos() > f.Package {
+			break
+		} // if
+		for _, c := range cg.List {
+			if generatedRe.MatchString(c.Text) {
+				return true
+			} // if
+		} // for c
+	} // for cg
+	return false
+}
+
+// fileName returns the name of the parsed file, or "" if unknown.
+func (info *fileInfo) fileName() string {
+	if info.fs == nil || !info.f.Package.IsValid() {
+		return ""
+	} // if
+	return info.fs.Position(info.f.Package).Filename
+}
+
+// ignoreFile returns true if all declarations of the file are ignored.
+func (info *fileInfo) ignoreFile() bool {
+	if gOptions.IgnoreGenerated && isGenerated(info.f) {
+		return true
+	} // if
+	return gOptions.IgnoreTests && strings.HasSuffix(info.fileName(), "_test.go")
+}
+
+func isExportedSymbol(sym string) bool {
+	for _, name := range strings.Split(sym, ".") {
+		if !ast.IsExported(name) {
+			return false
+		} // if
+	} // for name
+	return true
+}
+
+// matchIgnoredName returns true if a symbol, or the method name of it,
+// matches any of the ignored name patterns.
+func matchIgnoredName(sym string) bool {
+	name := sym[strings.LastIndex(sym, ".")+1:]
+	for _, pat := range gOptions.IgnoreNames {
+		if m, _ := path.Match(pat, sym); m {
+			return true
+		} // if
+		if m, _ := path.Match(pat, name); m {
+			return true
+		} // if
+	} // for pat
+	return false
+}
+
+// ignoreSymbol returns true if a declared symbol is ignored.
+func ignoreSymbol(sym string) bool {
+	return matchIgnoredName(sym) || gOptions.IgnoreUnexported && !isExportedSymbol(sym)
+}
+
+// filterNames removes the ignored names from the lines of a const or var
+// declaration, together with their values if each name has its own. It
+// returns the number of removed names and the remaining names.
+func filterNames(f *fragment) (removed int, kept []string) {
+	lines := f.Parts[:0]
+	for _, p := range f.Parts {
+		line := p.(*fragment)
+		names, values := line.Parts[0].(*fragment), line.Parts[2].(*fragment)
+		aligned := len(values.Parts) == len(names.Parts)
+		var ns, vs []diffFragment
+		for i, n := range names.Parts {
+			if ignoreSymbol(n.(*stringFrag).source) {
+				continue
+			} // if
+			ns = append(ns, n)
+			if aligned {
+				vs = append(vs, values.Parts[i])
+			} // if
+		} // for i, n
+		if !aligned && len(ns) > 0 {
+			// e.g. a, b = f(), the names can not be separated
+			ns, vs = names.Parts, values.Parts
+		} // if
+		removed += len(names.Parts) - len(ns)
+		if len(ns) == 0 {
+			continue
+		} // if
+		names.Parts, values.Parts = ns, vs
+		for _, n := range ns {
+			kept = append(kept, n.(*stringFrag).source)
+		} // for n
+		lines = append(lines, line)
+	} // for p
+	f.Parts = lines
+	return removed, kept
+}
+
+// filterSpec returns a copy of a var spec with only the names kept.
+func filterSpec(sp *ast.ValueSpec, kept []string) *ast.ValueSpec {
+	cp := *sp
+	if len(sp.Values) != len(sp.Names) {
+		return &cp
+	} // if
+	cp.Names, cp.Values = nil, nil
+	for i, name := range sp.Names {
+		for _, k := range kept {
+			if name.Name == k {
+				cp.Names, cp.Values = append(cp.Names, name), append(cp.Values, sp.Values[i])
+				break
+			} // if
+		} // for k
+	} // for i, name
+	return &cp
+}
+
+// filterIgnored removes the ignored declarations from the fragments and
+// counts them in info.ignored, each name of a const or var declaration as
+// one.
+func (info *fileInfo) filterIgnored() {
+	all := info.ignoreFile()
+	if !all && !gOptions.IgnoreUnexported && len(gOptions.IgnoreNames) == 0 {
+		return
+	} // if
+
+	for _, frag := range []*fragment{info.types, info.vars, info.funcs} {
+		parts := frag.Parts[:0]
+		for _, p := range frag.Parts {
+			f := p.(*fragment)
+			if all {
+				// consts and vars count by names
+				info.ignored += len(partSymbols(info, p))
+				if d, ok := f.node.(*ast.GenDecl); ok {
+					info.consts.remove(d, nil)
+				} // if
+				continue
+			} // if
+			switch nd := f.node.(type) {
+			case *ast.GenDecl, *ast.ValueSpec:
+				// consts and vars are filtered by names
+				removed, kept := filterNames(f)
+				info.ignored += removed
+				if d, ok := nd.(*ast.GenDecl); ok {
+					info.consts.remove(d, ignoreSymbol)
+				} else if len(kept) > 0 {
+					f.node = filterSpec(nd.(*ast.ValueSpec), kept)
+				} // else if
+				if len(kept) == 0 {
+					continue
+				} // if
+			default:
+				if ignoreSymbol(partSymbols(info, p)[0]) {
+					info.ignored++
+					continue
+				} // if
+			}
+			parts = append(parts, p)
+		} // for p
+		frag.Parts = parts
+	} // for frag
+}
+
+// showIgnored shows the number of ignored declarations, if any.
+func showIgnored(orgInfo, newInfo *fileInfo) {
+	if orgInfo.ignored == 0 && newInfo.ignored == 0 {
+		return
+	} // if
+	showNoteLine(fmt.Sprintf("ignored %d original and %d new declarations", orgInfo.ignored, newInfo.ignored))
+}
@@ -0,0 +1,169 @@
+package godiff
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestIsGenerated(t *testing.T) {
+	for _, c := range []struct {
+		src       string
+		generated bool
+	}{
+		{"// Code generated by stringer. DO NOT EDIT.\n\npackage main\n", true},
+		{"// Code generated by hand.\n\npackage main\n", false},
+		{"package main\n\n// Code generated by stringer. DO NOT EDIT.\n", false},
+	} {
+		f, err := parser.ParseFile(token.NewFileSet(), "", c.src, parser.ParseComments)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, c.src, isGenerated(f), c.generated)
+	} // for c
+}
+
+func TestDiff_Ignore(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{IgnoreUnexported: true, IgnoreNames: []string{"String", "*_gen"}}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+type Kind int
+
+func (k Kind) String() string {
+	return "a"
+}
+
+func helper() int {
+	return 1
+}
+
+func Parse_gen() {
+}
+
+func Run() {
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+type Kind int
+
+func (k Kind) String() string {
+	return "b"
+}
+
+func helper() int {
+	return 2
+}
+
+func Run() {
+	helper()
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "orgInfo.ignored", orgInfo.ignored, 3)
+	assert.Equal(t, "newInfo.ignored", newInfo.ignored, 2)
+
+	diff(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", string(buf), `    func Run() {
++++     helper()
+    }
+::: ignored 3 original and 2 new declarations
+`)
+}
+
+func TestParse_IgnoreGenerated(t *testing.T) {
+	gOptions = Options{IgnoreGenerated: true}
+	defer func() { gOptions = Options{} }()
+
+	info, err := parse("", `// Code generated by stringer. DO NOT EDIT.
+
+package main
+
+const a = 1
+
+func f() {
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ignored", info.ignored, 2)
+	assert.Equal(t, "len(info.vars.Parts)", len(info.vars.Parts), 0)
+	assert.Equal(t, "len(info.consts.defs)", len(info.consts.defs), 0)
+}
+
+func TestDiff_IgnoreNames(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte(`package main
+
+const (
+	A = iota
+	b
+	C
+)
+
+var X, y = 1, 2
+`), "b.go", []byte(`package main
+
+const (
+	A = iota
+	b
+	C
+	D
+)
+
+var X, y = 1, 3
+`), &buf, Options{NoColor: true, IgnoreUnexported: true})
+	assert.NoError(t, err)
+	assert.StringEqual(t, "diff", string(buf), `    const(
+        A = iota
+        C
++++     D
+    )
+
+::: ignored 2 original and 2 new declarations
+`)
+}
+
+func TestFilterIgnored_CountNames(t *testing.T) {
+	gOptions = Options{IgnoreUnexported: true}
+	defer func() { gOptions = Options{} }()
+
+	info, err := parse("", `
+package main
+
+const (
+	a = iota
+	b
+)
+
+var c, d = 1, 2
+
+var (
+	E = 1
+	f = 2
+)
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Whole and partly ignored declarations count each name.
+	assert.Equal(t, "ignored", info.ignored, 5)
+}
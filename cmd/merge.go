@@ -0,0 +1,620 @@
+package godiff
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/daviddengcn/go-villa"
+)
+
+// mergeUnit is a top level declaration, or a spec of a parenthesized type or
+// var declaration, of a file being merged.
+type mergeUnit struct {
+	frag diffFragment
+	// text is the source from the end of the previous declaration to the end
+	// of the line of this one, including comments, with leading blank lines
+	// removed.
+	text string
+	// kwOff is the offset of the keyword in text, -1 for a spec in a group.
+	kwOff int
+	// nodeOff is the offset of the declaration, or spec, in text.
+	nodeOff int
+	keyword string
+	grouped bool
+	// base and pair are the matched units in the base, and in the other side
+	// for units added on both sides.
+	base, pair *mergeUnit
+}
+
+// topText returns the source of the unit as a top level declaration.
+func (u *mergeUnit) topText() string {
+	if u.kwOff >= 0 {
+		return u.text
+	} // if
+	return dedent(u.text[:u.nodeOff] + u.keyword + " " + u.text[u.nodeOff:])
+}
+
+// dedent removes one level of indentation of the lines of a spec in a group.
+func dedent(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, "\t")
+	} // for i, line
+	return strings.Join(lines, "\n")
+}
+
+// specText returns the source of the unit as a spec in a group.
+func (u *mergeUnit) specText() string {
+	if u.kwOff < 0 || u.keyword == "func" || u.keyword == "const" {
+		return u.text
+	} // if
+	return u.text[:u.kwOff] + u.text[u.nodeOff:]
+}
+
+// key is used to compare units of different versions.
+func (u *mergeUnit) key() string {
+	return strings.TrimSpace(u.topText())
+}
+
+// mergeItem is a top level item of a file: a unit, or a group of units.
+type mergeItem struct {
+	unit *mergeUnit
+	// open and close are the sources around the units of a group.
+	open, close string
+	units       []*mergeUnit
+}
+
+// mergeFile is a version of a file being merged.
+type mergeFile struct {
+	info    *fileInfo
+	src     []byte
+	header  string // package clause and imports
+	trailer string // after the last declaration
+	items   []*mergeItem
+	// units are in the order of the source.
+	units  []*mergeUnit
+	byNode map[ast.Node]*mergeUnit
+}
+
+// lineEnd returns the offset of the end of the line containing offset off.
+func lineEnd(src []byte, off int) int {
+	if p := bytes.IndexByte(src[off:], '\n'); p >= 0 {
+		return off + p
+	} // if
+	return len(src)
+}
+
+// newMergeUnit creates a unit of the source from offset start to the end of
+// the line of end, with the keyword at kw (-1 if none) and the node at node.
+func newMergeUnit(src []byte, start, kw, node, end int, keyword string) *mergeUnit {
+	end = lineEnd(src, end)
+	text := string(src[start:end])
+	trimmed := strings.TrimLeft(text, " \t\n")
+	// keep the indentation of the first line
+	if p := strings.LastIndex(text[:len(text)-len(trimmed)], "\n"); p >= 0 {
+		trimmed = text[p+1:]
+	} // if
+	cut := len(text) - len(trimmed)
+	u := &mergeUnit{text: trimmed, kwOff: -1, nodeOff: node - start - cut, keyword: keyword}
+	if kw >= 0 {
+		u.kwOff = kw - start - cut
+	} // if
+	return u
+}
+
+func parseMergeFile(fn string, src []byte) (*mergeFile, error) {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, fn, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	} // if
+	info := &fileInfo{f: f, fs: fs}
+	info.collect()
+
+	mf := &mergeFile{info: info, src: src, byNode: make(map[ast.Node]*mergeUnit)}
+	off := func(p token.Pos) int {
+		return fs.Position(p).Offset
+	}
+
+	prevEnd := lineEnd(src, off(f.Name.End()))
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			prevEnd = lineEnd(src, off(d.End()))
+		} // if
+	} // for decl
+	mf.header = string(src[:prevEnd])
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			u := newMergeUnit(src, prevEnd, off(d.Type.Func), off(d.Name.Pos()), off(d.End()), "func")
+			mf.byNode[d] = u
+			mf.items = append(mf.items, &mergeItem{unit: u})
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				continue
+			} // if
+			keyword := d.Tok.String()
+			if d.Tok == token.CONST || !d.Lparen.IsValid() {
+				u := newMergeUnit(src, prevEnd, off(d.TokPos), off(d.Specs[0].Pos()), off(d.End()), keyword)
+				if d.Tok == token.CONST {
+					u.nodeOff = u.kwOff
+					mf.byNode[d] = u
+				} else {
+					mf.byNode[d.Specs[0]] = u
+				} // else
+				mf.items = append(mf.items, &mergeItem{unit: u})
+				break
+			} // if
+
+			item := &mergeItem{}
+			lp := off(d.Lparen) + 1
+			item.open = strings.TrimLeft(string(src[prevEnd:lp]), "\n")
+			start := lp
+			for _, spec := range d.Specs {
+				end := off(spec.End())
+				if vs, ok := spec.(*ast.ValueSpec); ok && vs.Comment != nil {
+					end = off(vs.Comment.End())
+				} else if ts, ok := spec.(*ast.TypeSpec); ok && ts.Comment != nil {
+					end = off(ts.Comment.End())
+				} // else if
+				u := newMergeUnit(src, start, -1, off(spec.Pos()), end, keyword)
+				u.grouped = true
+				mf.byNode[spec] = u
+				item.units = append(item.units, u)
+				start = lineEnd(src, end)
+			} // for spec
+			item.close = strings.TrimSpace(string(src[start : off(d.Rparen)+1]))
+			mf.items = append(mf.items, item)
+		default:
+			continue
+		}
+		prevEnd = lineEnd(src, off(decl.End()))
+	} // for decl
+	mf.trailer = strings.TrimSpace(string(src[prevEnd:]))
+
+	for _, frag := range []*fragment{info.types, info.vars, info.funcs} {
+		for _, p := range frag.Parts {
+			if u := mf.byNode[p.(*fragment).node]; u != nil {
+				u.frag = p
+			} // if
+		} // for p
+	} // for frag
+	for _, item := range mf.items {
+		if item.unit != nil {
+			mf.units = append(mf.units, item.unit)
+		} // if
+		mf.units = append(mf.units, item.units...)
+	} // for item
+	return mf, nil
+}
+
+// groupUnits returns the units of a file for the fragments of a group.
+func (mf *mergeFile) groupUnits(parts []diffFragment) (units []*mergeUnit) {
+	for _, p := range parts {
+		units = append(units, mf.byNode[p.(*fragment).node])
+	} // for p
+	return units
+}
+
+// matchBase sets the base of the units in a side matched with the base.
+func matchBase(base, side *mergeFile) {
+	for _, grp := range [][2]*fragment{
+		{base.info.types, side.info.types},
+		{base.info.vars, side.info.vars},
+		{base.info.funcs, side.info.funcs},
+	} {
+		baseUnits, sideUnits := base.groupUnits(grp[0].Parts), side.groupUnits(grp[1].Parts)
+		_, _, matB := matchParts(grp[0].Parts, grp[1].Parts)
+		for j, i := range matB {
+			if i >= 0 {
+				sideUnits[j].base = baseUnits[i]
+			} // if
+		} // for j, i
+	} // for grp
+}
+
+// matchAdded pairs the units added on both sides declaring the same symbols.
+func matchAdded(ours, theirs *mergeFile) {
+	symbolKey := func(mf *mergeFile, u *mergeUnit) string {
+		syms := partSymbols(mf.info, u.frag)
+		sort.Strings(syms)
+		return u.keyword + " " + strings.Join(syms, ",")
+	}
+	added := make(map[string]*mergeUnit)
+	for _, u := range ours.units {
+		if u.base == nil && u.frag != nil {
+			added[symbolKey(ours, u)] = u
+		} // if
+	} // for u
+	for _, u := range theirs.units {
+		if u.base != nil || u.frag == nil {
+			continue
+		} // if
+		if o := added[symbolKey(theirs, u)]; o != nil && o.pair == nil {
+			o.pair, u.pair = u, o
+		} // if
+	} // for u
+}
+
+// conflictText returns the source with conflict markers of a unit changed on
+// both sides. Either text may be empty for a deleted unit.
+func conflictText(ours, theirs string) string {
+	var b strings.Builder
+	b.WriteString("<<<<<<< ours\n")
+	if ours != "" {
+		b.WriteString(ours + "\n")
+	} // if
+	b.WriteString("=======\n")
+	if theirs != "" {
+		b.WriteString(theirs + "\n")
+	} // if
+	b.WriteString(">>>>>>> theirs")
+	return b.String()
+}
+
+// importKey returns an import as a "name path" string.
+func importKey(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name + " " + imp.Path.Value
+	} // if
+	return imp.Path.Value
+}
+
+// importKeys returns the keys of the imports of a file.
+func importKeys(f *ast.File) villa.StrSet {
+	keys := villa.NewStrSet()
+	for _, imp := range f.Imports {
+		keys.Put(importKey(imp))
+	} // for imp
+	return keys
+}
+
+// importDecls returns the import declarations of a file.
+func importDecls(f *ast.File) (decls []*ast.GenDecl) {
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			decls = append(decls, d)
+		} // if
+	} // for decl
+	return decls
+}
+
+// lineRange returns the offsets of the whole lines from pos to end, including
+// the newline of the last one.
+func (mf *mergeFile) lineRange(pos, end token.Pos) (int, int) {
+	start := mf.info.fs.Position(pos).Offset
+	start = bytes.LastIndexByte(mf.src[:start], '\n') + 1
+	stop := lineEnd(mf.src, mf.info.fs.Position(end).Offset)
+	if stop < len(mf.src) {
+		stop++
+	} // if
+	return start, stop
+}
+
+// docPos returns the position of a node including its doc comment.
+func docPos(doc *ast.CommentGroup, n ast.Node) token.Pos {
+	if doc != nil {
+		return doc.Pos()
+	} // if
+	return n.Pos()
+}
+
+// specLines returns the source lines of an import spec of d, with its
+// comments, as a line of a parenthesized block.
+func (mf *mergeFile) specLines(d *ast.GenDecl, imp *ast.ImportSpec) string {
+	if d.Lparen.IsValid() {
+		start, end := mf.lineRange(docPos(imp.Doc, imp), imp.End())
+		return string(mf.src[start:end])
+	} // if
+	start := mf.info.fs.Position(imp.Pos()).Offset
+	return "\t" + string(mf.src[start:lineEnd(mf.src, start)]) + "\n"
+}
+
+// mergeImports returns the header of the merged file: that of ours with the
+// imports removed by theirs deleted and those added by theirs inserted after
+// the import preceding them in theirs. Comments and grouping are kept.
+func mergeImports(base, ours, theirs *mergeFile) string {
+	inBase, inOurs, inTheirs := importKeys(base.info.f), importKeys(ours.info.f), importKeys(theirs.info.f)
+	src := ours.header
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	// the kept imports of ours and their declarations
+	kept := make(map[string]*ast.ImportSpec)
+	declOf := make(map[*ast.ImportSpec]*ast.GenDecl)
+	var firstKept *ast.ImportSpec
+	for _, d := range importDecls(ours.info.f) {
+		var removed []*ast.ImportSpec
+		for _, sp := range d.Specs {
+			imp := sp.(*ast.ImportSpec)
+			if k := importKey(imp); inBase.In(k) && !inTheirs.In(k) {
+				removed = append(removed, imp)
+			} else {
+				kept[k], declOf[imp] = imp, d
+				if firstKept == nil {
+					firstKept = imp
+				} // if
+			} // else
+		} // for sp
+		if len(removed) == len(d.Specs) {
+			start, end := ours.lineRange(docPos(d.Doc, d), d.End())
+			edits = append(edits, edit{start: start, end: end})
+			continue
+		} // if
+		for _, imp := range removed {
+			start, end := ours.lineRange(docPos(imp.Doc, imp), imp.End())
+			edits = append(edits, edit{start: start, end: end})
+		} // for imp
+	} // for d
+
+	// added imports, keyed by the kept import of ours they follow, or nil
+	added := make(map[*ast.ImportSpec][]string)
+	var anchors []*ast.ImportSpec
+	var anchor *ast.ImportSpec
+	for _, d := range importDecls(theirs.info.f) {
+		for _, sp := range d.Specs {
+			imp := sp.(*ast.ImportSpec)
+			k := importKey(imp)
+			if a, ok := kept[k]; ok {
+				anchor = a
+				continue
+			} // if
+			if inBase.In(k) || inOurs.In(k) {
+				continue
+			} // if
+			if _, ok := added[anchor]; !ok {
+				anchors = append(anchors, anchor)
+			} // if
+			added[anchor] = append(added[anchor], theirs.specLines(d, imp))
+			inOurs.Put(k)
+		} // for sp
+	} // for d
+	if len(edits) == 0 && len(anchors) == 0 {
+		return src
+	} // if
+
+	// the lines added before and after the spec of an import "a" declaration,
+	// which becomes a block
+	var blocks []*ast.GenDecl
+	around := make(map[*ast.GenDecl]*[2]string)
+	for _, a := range anchors {
+		lines := strings.Join(added[a], "")
+		if a == nil && firstKept == nil {
+			// no imports are left in ours
+			p := lineEnd(ours.src, ours.info.fs.Position(ours.info.f.Name.End()).Offset)
+			edits = append(edits, edit{start: p, end: p, text: "\n\nimport (\n" + lines + ")"})
+			continue
+		} // if
+		before := a == nil
+		if before {
+			a = firstKept
+		} // if
+		if d := declOf[a]; !d.Lparen.IsValid() {
+			if around[d] == nil {
+				blocks, around[d] = append(blocks, d), new([2]string)
+			} // if
+			if before {
+				around[d][0] = lines
+			} else {
+				around[d][1] = lines
+			} // else
+			continue
+		} // if
+		start, end := ours.lineRange(docPos(a.Doc, a), a.End())
+		if !before {
+			start = end
+		} // if
+		edits = append(edits, edit{start: start, end: start, text: lines})
+	} // for a
+	for _, d := range blocks {
+		start := ours.info.fs.Position(d.Pos()).Offset
+		end := lineEnd(ours.src, ours.info.fs.Position(d.End()).Offset)
+		spec := "\t" + src[ours.info.fs.Position(d.Specs[0].Pos()).Offset:end] + "\n"
+		edits = append(edits, edit{start: start, end: end, text: "import (\n" + around[d][0] + spec + around[d][1] + ")"})
+	} // for d
+
+	// Applied from the end, removals before insertions at the same offset.
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start > edits[j].start
+		} // if
+		return edits[i].end > edits[j].end
+	})
+	for _, e := range edits {
+		if e.end > len(src) {
+			e.end = len(src)
+		} // if
+		src = src[:e.start] + e.text + src[e.end:]
+	} // for e
+	return strings.TrimRight(src, " \t\n")
+}
+
+// Merge merges the declaration level changes of ours and theirs from base.
+// Independent changes, e.g. functions added by both sides, are merged
+// automatically. Conflict markers are left where a declaration is changed
+// differently on both sides, and conflicts is the number of them.
+func Merge(baseSrc, oursSrc, theirsSrc []byte) (merged []byte, conflicts int, err error) {
+	// Options, e.g. ignore rules, must not affect the declarations collected.
+	defer func(options Options) { gOptions = options }(gOptions)
+	gOptions = Options{}
+
+	base, err := parseMergeFile("base", baseSrc)
+	if err != nil {
+		return nil, 0, err
+	} // if
+	ours, err := parseMergeFile("ours", oursSrc)
+	if err != nil {
+		return nil, 0, err
+	} // if
+	theirs, err := parseMergeFile("theirs", theirsSrc)
+	if err != nil {
+		return nil, 0, err
+	} // if
+
+	matchBase(base, ours)
+	matchBase(base, theirs)
+	matchAdded(ours, theirs)
+
+	oursOfBase, theirsOfBase := make(map[*mergeUnit]*mergeUnit), make(map[*mergeUnit]*mergeUnit)
+	for _, u := range ours.units {
+		if u.base != nil {
+			oursOfBase[u.base] = u
+		} // if
+	} // for u
+	for _, u := range theirs.units {
+		if u.base != nil {
+			theirsOfBase[u.base] = u
+		} // if
+	} // for u
+
+	// inserts maps an ours unit to the theirs-only sources following it. The
+	// key nil is for the ones before any matched unit.
+	inserts := make(map[*mergeUnit][]string)
+	var anchor *mergeUnit
+	for _, t := range theirs.units {
+		var o *mergeUnit
+		switch {
+		case t.pair != nil:
+			o = t.pair
+		case t.base != nil:
+			o = oursOfBase[t.base]
+			if o == nil && t.key() != t.base.key() {
+				// deleted by ours, modified by theirs
+				inserts[anchor] = append(inserts[anchor], conflictText("", t.topText()))
+				conflicts++
+			} // if
+		default:
+			inserts[anchor] = append(inserts[anchor], t.topText())
+		}
+		if o != nil {
+			anchor = o
+		} // if
+	} // for t
+
+	// resolve returns the merged source of an ours unit, "" if deleted.
+	resolve := func(o *mergeUnit, text func(u *mergeUnit) string) string {
+		var t *mergeUnit
+		if o.base != nil {
+			t = theirsOfBase[o.base]
+		} else {
+			t = o.pair
+		} // else
+		switch {
+		case o.base == nil && t == nil:
+			return text(o)
+		case t == nil:
+			// deleted by theirs
+			if o.key() == o.base.key() {
+				return ""
+			} // if
+			conflicts++
+			return conflictText(text(o), "")
+		case o.base != nil && o.key() == o.base.key():
+			return text(t)
+		case o.base != nil && t.key() == o.base.key() || o.key() == t.key():
+			return text(o)
+		}
+		conflicts++
+		return conflictText(text(o), text(t))
+	}
+
+	var out []string
+	out = append(out, mergeImports(base, ours, theirs))
+	var pending []string
+	flush := func() {
+		out = append(out, pending...)
+		pending = nil
+	}
+	pending = inserts[nil]
+	matched := func(u *mergeUnit) bool {
+		return u.base != nil || u.pair != nil
+	}
+	for _, item := range ours.items {
+		if item.unit != nil {
+			if matched(item.unit) {
+				flush()
+			} // if
+			if s := resolve(item.unit, (*mergeUnit).topText); s != "" {
+				out = append(out, s)
+			} // if
+			pending = append(pending, inserts[item.unit]...)
+			continue
+		} // if
+
+		for _, u := range item.units {
+			if matched(u) {
+				flush()
+				break
+			} // if
+		} // for u
+		var specs []string
+		for _, u := range item.units {
+			if s := resolve(u, (*mergeUnit).specText); s != "" {
+				specs = append(specs, s)
+			} // if
+			pending = append(pending, inserts[u]...)
+		} // for u
+		if len(specs) > 0 {
+			out = append(out, item.open+"\n"+strings.Join(specs, "\n")+"\n"+item.close)
+		} // if
+	} // for item
+	flush()
+	if ours.trailer != "" {
+		out = append(out, ours.trailer)
+	} // if
+
+	merged = []byte(strings.Join(out, "\n\n") + "\n")
+	if conflicts == 0 {
+		if formatted, err := format.Source(merged); err == nil {
+			merged = formatted
+		} // if
+	} // if
+	return merged, conflicts, nil
+}
+
+// ExecMerge merges the files as a git merge driver: the result is written to
+// oursFn. If any version fails to parse, the files are merged as a whole. Use it with
+//
+//	git config merge.godiff.driver "go-diff merge %O %A %B"
+func ExecMerge(baseFn, oursFn, theirsFn string) (conflicts int, err error) {
+	if err := checkStdin(baseFn, oursFn, theirsFn); err != nil {
+		return 0, err
+	} // if
+	var srcs [3][]byte
+	for i, fn := range []string{baseFn, oursFn, theirsFn} {
+		if srcs[i], err = readSource(fn); err != nil {
+			return 0, err
+		} // if
+	} // for i, fn
+	merged, conflicts, err := Merge(srcs[0], srcs[1], srcs[2])
+	if err != nil {
+		// A version does not parse, so ours is not left as is to lose theirs.
+		merged, conflicts = mergeWhole(srcs[0], srcs[1], srcs[2])
+	} // if
+	return conflicts, ioutil.WriteFile(oursFn, merged, 0644)
+}
+
+// mergeWhole merges files as a whole: the changed side is taken if only one
+// side changed, otherwise the whole files are left with conflict markers.
+func mergeWhole(baseSrc, oursSrc, theirsSrc []byte) (merged []byte, conflicts int) {
+	switch {
+	case bytes.Equal(oursSrc, theirsSrc), bytes.Equal(theirsSrc, baseSrc):
+		return oursSrc, 0
+	case bytes.Equal(oursSrc, baseSrc):
+		return theirsSrc, 0
+	}
+	trim := func(src []byte) string {
+		return strings.TrimSuffix(string(src), "\n")
+	}
+	return []byte(conflictText(trim(oursSrc), trim(theirsSrc)) + "\n"), 1
+}
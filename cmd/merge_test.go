@@ -0,0 +1,286 @@
+package godiff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+const mergeBase = `package main
+
+import "fmt"
+
+// a prints a.
+func a() {
+	fmt.Println("a")
+}
+
+type (
+	A int
+	B string
+)
+
+func b() {
+}
+`
+
+func TestMerge_Independent(t *testing.T) {
+	ours := `package main
+
+import "fmt"
+
+// a prints a.
+func a() {
+	fmt.Println("a")
+}
+
+type (
+	A int
+	B string
+)
+
+func b() {
+	a()
+}
+
+func c() {
+}
+`
+	theirs := `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// a prints a.
+func a() {
+	fmt.Println("a", os.Args)
+}
+
+type (
+	A int64
+	B string
+)
+
+func b() {
+}
+
+// d is new.
+func d() {
+}
+`
+	merged, conflicts, err := Merge([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "conflicts", conflicts, 0)
+	assert.StringEqual(t, "merged", string(merged), `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// a prints a.
+func a() {
+	fmt.Println("a", os.Args)
+}
+
+type (
+	A int64
+	B string
+)
+
+func b() {
+	a()
+}
+
+func c() {
+}
+
+// d is new.
+func d() {
+}
+`)
+}
+
+func TestMerge_Conflict(t *testing.T) {
+	ours := `package main
+
+import "fmt"
+
+// a prints a.
+func a() {
+	fmt.Println("ours")
+}
+
+type (
+	A int
+)
+
+func b() {
+}
+`
+	theirs := `package main
+
+import "fmt"
+
+// a prints a.
+func a() {
+	fmt.Println("theirs")
+}
+
+type (
+	A int
+	B []byte
+)
+`
+	merged, conflicts, err := Merge([]byte(mergeBase), []byte(ours), []byte(theirs))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "conflicts", conflicts, 2)
+	assert.StringEqual(t, "merged", string(merged), `package main
+
+import "fmt"
+
+<<<<<<< ours
+// a prints a.
+func a() {
+	fmt.Println("ours")
+}
+=======
+// a prints a.
+func a() {
+	fmt.Println("theirs")
+}
+>>>>>>> theirs
+
+type (
+	A int
+)
+
+<<<<<<< ours
+=======
+type B []byte
+>>>>>>> theirs
+`)
+}
+
+func TestMerge_Imports(t *testing.T) {
+	base := `package main
+
+// Standard and local packages.
+import (
+	"bytes"
+	"fmt" // printing
+
+	"example.com/a"
+)
+`
+	ours := `package main
+
+// Standard and local packages.
+import (
+	"bytes"
+	"fmt" // printing
+
+	"example.com/a"
+	// b is new in ours.
+	"example.com/b"
+)
+`
+	theirs := `package main
+
+// Standard and local packages.
+import (
+	"fmt" // printing
+	"os"
+
+	"example.com/a"
+	"example.com/c" // c is new in theirs
+)
+`
+	merged, conflicts, err := Merge([]byte(base), []byte(ours), []byte(theirs))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "conflicts", conflicts, 0)
+	assert.StringEqual(t, "merged", string(merged), `package main
+
+// Standard and local packages.
+import (
+	"fmt" // printing
+	"os"
+
+	"example.com/a"
+	"example.com/c" // c is new in theirs
+	// b is new in ours.
+	"example.com/b"
+)
+`)
+
+	// A single import becomes a block.
+	merged, _, err = Merge([]byte("package main\n\nimport \"fmt\"\n"), []byte("package main\n\nimport \"fmt\" // printing\n"),
+		[]byte("package main\n\nimport (\n\t\"bytes\"\n\t\"fmt\"\n\t\"os\"\n)\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.StringEqual(t, "single", string(merged), "package main\n\nimport (\n\t\"bytes\"\n\t\"fmt\" // printing\n\t\"os\"\n)\n")
+
+	// All imports removed.
+	merged, _, err = Merge([]byte("package main\n\nimport \"fmt\"\n\nfunc a() {}\n"), []byte("package main\n\nimport \"fmt\"\n\nfunc a() {}\n"),
+		[]byte("package main\n\nfunc a() {}\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.StringEqual(t, "removed", string(merged), "package main\n\nfunc a() {}\n")
+}
+
+func TestExecMerge_ParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-diff-merge")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, src string) string {
+		fn := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(src), 0644))
+		return fn
+	}
+	base := write("base.go", "package main\n\nfunc a() {}\n")
+	theirs := write("theirs.go", "package main\n\nfunc a() {}\n\nfunc b() {}\n")
+
+	// ours does not parse, so the whole files conflict.
+	ours := write("ours.go", "package main\n\nfunc a( {}\n")
+	conflicts, err := ExecMerge(base, ours, theirs)
+	assert.NoError(t, err)
+	assert.Equal(t, "conflicts", conflicts, 1)
+	merged, _ := ioutil.ReadFile(ours)
+	assert.StringEqual(t, "merged", string(merged), `<<<<<<< ours
+package main
+
+func a( {}
+=======
+package main
+
+func a() {}
+
+func b() {}
+>>>>>>> theirs
+`)
+
+	// ours is unchanged, theirs is taken even if base does not parse.
+	base = write("base.go", "package main\n\nfunc a( {}\n")
+	ours = write("ours.go", "package main\n\nfunc a( {}\n")
+	conflicts, err = ExecMerge(base, ours, theirs)
+	assert.NoError(t, err)
+	assert.Equal(t, "unchanged conflicts", conflicts, 0)
+	merged, _ = ioutil.ReadFile(ours)
+	assert.StringEqual(t, "theirs", string(merged), "package main\n\nfunc a() {}\n\nfunc b() {}\n")
+}
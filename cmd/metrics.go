@@ -0,0 +1,185 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+
+	"github.com/golangplus/fmt"
+)
+
+// funcMetrics are size and complexity metrics of a function.
+type funcMetrics struct {
+	complexity int // cyclomatic complexity
+	depth      int // maximum nesting depth of statements
+	stmts      int // number of statements
+	params     int // number of parameters
+}
+
+func isNesting(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+		return true
+	}
+	return false
+}
+
+// countStmts returns the number of statements in a list, excluding case
+// clauses and empty statements.
+func countStmts(list []ast.Stmt) (cnt int) {
+	for _, st := range list {
+		switch st.(type) {
+		case *ast.CaseClause, *ast.CommClause, *ast.EmptyStmt:
+		default:
+			cnt++
+		}
+	} // for st
+	return cnt
+}
+
+func newFuncMetrics(fd *ast.FuncDecl) (m funcMetrics) {
+	m.complexity = 1
+	m.params = len(fieldTypes(fd.Type.Params))
+	if fd.Body == nil {
+		return m
+	} // if
+
+	depth := 0
+	var nestings []bool
+	// the IfStmts of else-if clauses, which are as deep as their parents
+	elseIfs := make(map[ast.Node]bool)
+	ast.Inspect(fd.Body, func(n ast.Node) bool {
+		if n == nil {
+			if nestings[len(nestings)-1] {
+				depth--
+			} // if
+			nestings = nestings[:len(nestings)-1]
+			return true
+		} // if
+
+		if is, ok := n.(*ast.IfStmt); ok && is.Else != nil {
+			if elseIf, ok := is.Else.(*ast.IfStmt); ok {
+				elseIfs[elseIf] = true
+			} // if
+		} // if
+		nesting := isNesting(n) && !elseIfs[n]
+		if nesting {
+			depth++
+			if depth > m.depth {
+				m.depth = depth
+			} // if
+		} // if
+		nestings = append(nestings, nesting)
+
+		switch nd := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			m.complexity++
+		case *ast.CaseClause:
+			if nd.List != nil {
+				m.complexity++
+			} // if
+		case *ast.CommClause:
+			if nd.Comm != nil {
+				m.complexity++
+			} // if
+		case *ast.BinaryExpr:
+			if nd.Op == token.LAND || nd.Op == token.LOR {
+				m.complexity++
+			} // if
+		}
+
+		switch nd := n.(type) {
+		case *ast.BlockStmt:
+			m.stmts += countStmts(nd.List)
+		case *ast.CaseClause:
+			m.stmts += countStmts(nd.Body)
+		case *ast.CommClause:
+			m.stmts += countStmts(nd.Body)
+		}
+		return true
+	})
+	return m
+}
+
+// annotateMetrics shows the metrics of a changed function before and after.
+func annotateMetrics(orgF, newF diffFragment) {
+	orgFd, ok1 := orgF.(*fragment).node.(*ast.FuncDecl)
+	newFd, ok2 := newF.(*fragment).node.(*ast.FuncDecl)
+	if !ok1 || !ok2 {
+		return
+	} // if
+	o, n := newFuncMetrics(orgFd), newFuncMetrics(newFd)
+	showNoteLine(fmt.Sprintf("complexity %d -> %d, depth %d -> %d, statements %d -> %d, parameters %d -> %d",
+		o.complexity, n.complexity, o.depth, n.depth, o.stmts, n.stmts, o.params, n.params))
+}
+
+// complexityDelta is the change of complexity of a function.
+type complexityDelta struct {
+	sym      string
+	org, new int
+}
+
+// maxComplexityDeltas is the maximum number of complexity increases shown in
+// the stat summary.
+const maxComplexityDeltas = 5
+
+// diffStat shows the numbers of added, removed and modified declarations and
+// the functions with the biggest complexity increases.
+func diffStat(orgInfo, newInfo *fileInfo) {
+	var deltas []complexityDelta
+	for _, grp := range []struct {
+		name     string
+		org, new *fragment
+	}{
+		{"types", orgInfo.types, newInfo.types},
+		{"vars", orgInfo.vars, newInfo.vars},
+		{"funcs", orgInfo.funcs, newInfo.funcs},
+	} {
+		mat, matA, matB := matchParts(grp.org.Parts, grp.new.Parts)
+		added, removed, modified := 0, 0, 0
+		for i, j := range matA {
+			if j < 0 {
+				removed++
+			} else if mat[i][j] > 0 {
+				modified++
+			} // else if
+		} // for i, j
+		for j, i := range matB {
+			if i < 0 {
+				added++
+			} // if
+
+			fd, ok := grp.new.Parts[j].(*fragment).node.(*ast.FuncDecl)
+			if !ok || i >= 0 && mat[i][j] == 0 {
+				continue
+			} // if
+			d := complexityDelta{sym: funcSymbol(fd), new: newFuncMetrics(fd).complexity}
+			if i >= 0 {
+				d.org = newFuncMetrics(grp.org.Parts[i].(*fragment).node.(*ast.FuncDecl)).complexity
+			} // if
+			if d.new > d.org {
+				deltas = append(deltas, d)
+			} // if
+		} // for j, i
+		fmtp.Fprintfln(gOut, "%s: %d added, %d removed, %d modified", grp.name, added, removed, modified)
+		gDiffs += added + removed + modified
+	} // for grp
+	if orgInfo.ignored > 0 || newInfo.ignored > 0 {
+		fmtp.Fprintfln(gOut, "ignored: %d original, %d new", orgInfo.ignored, newInfo.ignored)
+	} // if
+
+	if len(deltas) == 0 {
+		return
+	} // if
+	sort.SliceStable(deltas, func(i, j int) bool {
+		return deltas[i].new-deltas[i].org > deltas[j].new-deltas[j].org
+	})
+	if len(deltas) > maxComplexityDeltas {
+		deltas = deltas[:maxComplexityDeltas]
+	} // if
+	fmt.Fprintln(gOut, "biggest complexity increases:")
+	for _, d := range deltas {
+		fmtp.Fprintfln(gOut, "    %s: %d -> %d (+%d)", d.sym, d.org, d.new, d.new-d.org)
+	} // for d
+}
@@ -0,0 +1,114 @@
+package godiff
+
+import (
+	"go/ast"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestFuncMetrics(t *testing.T) {
+	info, err := parse("", `
+package main
+
+func f(a, b int, c string) {
+	if a > 0 && b > 0 {
+		for i := 0; i < a; i++ {
+			println(i)
+		}
+	} else {
+		switch c {
+		case "x":
+			return
+		default:
+		}
+	}
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := newFuncMetrics(info.funcs.Parts[0].(*fragment).node.(*ast.FuncDecl))
+	assert.Equal(t, "metrics", m, funcMetrics{complexity: 5, depth: 2, stmts: 5, params: 3})
+}
+
+func TestFuncMetrics_ElseIf(t *testing.T) {
+	info, err := parse("", `
+package main
+
+func f(a int) string {
+	if a == 0 {
+		return "zero"
+	} else if a == 1 {
+		return "one"
+	} else if a == 2 {
+		if a > 0 {
+			return "two"
+		}
+	}
+	return "many"
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := newFuncMetrics(info.funcs.Parts[0].(*fragment).node.(*ast.FuncDecl))
+	// An else-if chain is one level deep, the nested if makes it two.
+	assert.Equal(t, "metrics", m, funcMetrics{complexity: 5, depth: 2, stmts: 6, params: 1})
+}
+
+func TestDiffStat(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+
+	orgInfo, err := parse("", `
+package main
+
+type T int
+
+func f(a int) int {
+	return a
+}
+
+func g() {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+type T int
+
+var v = 1
+
+func f(a int) int {
+	if a > 0 {
+		return a
+	}
+	return -a
+}
+
+func h(a int) {
+	if a > 0 || a < -10 {
+		println(a)
+	}
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffStat(orgInfo, newInfo)
+
+	assert.StringEqual(t, "stat", strings.Split(string(buf), "\n"), strings.Split(
+		`types: 0 added, 0 removed, 0 modified
+vars: 1 added, 0 removed, 0 modified
+funcs: 1 added, 1 removed, 1 modified
+biggest complexity increases:
+    h: 0 -> 3 (+3)
+    f: 1 -> 2 (+1)
+`, "\n"))
+}
@@ -0,0 +1,317 @@
+package godiff
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"sort"
+)
+
+var (
+	// gInNormalized is set while converting an already normalized expression
+	// to lines.
+	gInNormalized bool
+	// gRawSource is set when fragments of the unnormalized source are wanted.
+	gRawSource bool
+)
+
+func normalizing() bool {
+	return gOptions.Normalize && !gInNormalized && !gRawSource
+}
+
+// normalizeExpr returns a canonical form of e. Redundant parentheses are
+// removed, operands of commutative operators are sorted, a > b becomes b < a,
+// and trivial operations like x + 0, x * 1, !!x and x && true are dropped.
+// Operands are sorted or swapped only if none of them has side effects, since
+// Go evaluates them from left to right. Chains of * are not reassociated as
+// float multiplication is not associative. Nodes of e are never modified;
+// changed nodes are copied.
+func normalizeExpr(e ast.Expr) ast.Expr {
+	return normExpr(e, token.LowestPrec)
+}
+
+// exprPrec returns the precedence of e as an operand.
+func exprPrec(e ast.Expr) int {
+	switch x := e.(type) {
+	case *ast.BinaryExpr:
+		return x.Op.Precedence()
+	case *ast.UnaryExpr, *ast.StarExpr:
+		return token.UnaryPrec
+	}
+	return token.HighestPrec
+}
+
+func parenIfNeeded(e ast.Expr, prec int) ast.Expr {
+	if exprPrec(e) < prec {
+		return &ast.ParenExpr{X: e}
+	}
+	return e
+}
+
+// keepsParen returns true if parentheses around e may be necessary for
+// parsing.
+func keepsParen(e ast.Expr) bool {
+	switch e.(type) {
+	case *ast.CompositeLit, *ast.FuncLit, *ast.FuncType, *ast.ChanType:
+		return true
+	}
+	return false
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok || keepsParen(p.X) {
+			return e
+		}
+		e = p.X
+	}
+}
+
+func isLiteral(e ast.Expr, lit string) bool {
+	switch x := unparen(e).(type) {
+	case *ast.BasicLit:
+		return x.Value == lit
+	case *ast.Ident:
+		return x.Name == lit
+	}
+	return false
+}
+
+// isPure returns true if evaluating e has no side effects and never panics.
+func isPure(e ast.Expr) bool {
+	switch x := e.(type) {
+	case *ast.Ident, *ast.BasicLit:
+		return true
+	case *ast.ParenExpr:
+		return isPure(x.X)
+	case *ast.UnaryExpr:
+		return x.Op != token.ARROW && isPure(x.X)
+	case *ast.BinaryExpr:
+		return x.Op != token.QUO && x.Op != token.REM && isPure(x.X) && isPure(x.Y)
+	case *ast.KeyValueExpr:
+		return isPure(x.Value)
+	case *ast.CompositeLit:
+		for _, el := range x.Elts {
+			if !isPure(el) {
+				return false
+			} // if
+		} // for el
+		return true
+	}
+	return false
+}
+
+func exprString(e ast.Expr) string {
+	var src bytes.Buffer
+	printer.Fprint(&src, token.NewFileSet(), e)
+	return src.String()
+}
+
+// normExpr normalizes e which is placed where an operand of precedence prec
+// is required.
+func normExpr(e ast.Expr, prec int) ast.Expr {
+	switch x := e.(type) {
+	case *ast.ParenExpr:
+		in := normExpr(x.X, token.LowestPrec)
+		if _, ok := in.(*ast.UnaryExpr); ok && prec == token.UnaryPrec || keepsParen(in) {
+			return &ast.ParenExpr{Lparen: x.Lparen, X: in, Rparen: x.Rparen}
+		} // if
+		return parenIfNeeded(in, prec)
+
+	case *ast.UnaryExpr:
+		in := normExpr(x.X, token.UnaryPrec)
+		switch x.Op {
+		case token.ADD:
+			return parenIfNeeded(in, prec)
+		case token.SUB, token.XOR, token.NOT:
+			if u, ok := unparen(in).(*ast.UnaryExpr); ok && u.Op == x.Op {
+				return parenIfNeeded(u.X, prec)
+			} // if
+		}
+		if x.Op == token.NOT {
+			if b, ok := unparen(in).(*ast.BinaryExpr); ok && (b.Op == token.EQL || b.Op == token.NEQ) {
+				nb := *b
+				nb.Op = negations[b.Op]
+				return parenIfNeeded(&nb, prec)
+			} // if
+		} // if
+		return &ast.UnaryExpr{OpPos: x.OpPos, Op: x.Op, X: in}
+
+	case *ast.BinaryExpr:
+		return parenIfNeeded(unparen(normBinary(x)), prec)
+
+	case *ast.StarExpr:
+		return &ast.StarExpr{Star: x.Star, X: normExpr(x.X, token.UnaryPrec)}
+
+	case *ast.SelectorExpr:
+		return &ast.SelectorExpr{X: normExpr(x.X, token.HighestPrec), Sel: x.Sel}
+
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: normExpr(x.X, token.HighestPrec), Lbrack: x.Lbrack,
+			Index: normalizeExpr(x.Index), Rbrack: x.Rbrack}
+
+	case *ast.SliceExpr:
+		s := *x
+		s.X = normExpr(x.X, token.HighestPrec)
+		for _, p := range []*ast.Expr{&s.Low, &s.High, &s.Max} {
+			if *p != nil {
+				*p = normalizeExpr(*p)
+			} // if
+		} // for p
+		return &s
+
+	case *ast.TypeAssertExpr:
+		ta := *x
+		ta.X = normExpr(x.X, token.HighestPrec)
+		return &ta
+
+	case *ast.CallExpr:
+		c := *x
+		c.Fun = normExpr(x.Fun, token.HighestPrec)
+		c.Args = make([]ast.Expr, len(x.Args))
+		for i, a := range x.Args {
+			c.Args[i] = normalizeExpr(a)
+		} // for i, a
+		return &c
+
+	case *ast.CompositeLit:
+		cl := *x
+		cl.Elts = make([]ast.Expr, len(x.Elts))
+		for i, el := range x.Elts {
+			cl.Elts[i] = normalizeExpr(el)
+		} // for i, el
+		return &cl
+
+	case *ast.KeyValueExpr:
+		return &ast.KeyValueExpr{Key: x.Key, Colon: x.Colon, Value: normalizeExpr(x.Value)}
+	}
+
+	return e
+}
+
+// identities maps an operator to the operand which can be removed on the
+// right side, and on the left side if the operator is commutative.
+var identities = map[token.Token]string{
+	token.ADD:  "0",
+	token.SUB:  "0",
+	token.OR:   "0",
+	token.XOR:  "0",
+	token.SHL:  "0",
+	token.SHR:  "0",
+	token.MUL:  "1",
+	token.QUO:  "1",
+	token.LAND: "true",
+	token.LOR:  "false",
+}
+
+var (
+	// a > b is equivalent to b < a
+	mirrors = map[token.Token]token.Token{token.GTR: token.LSS, token.GEQ: token.LEQ}
+	// !(a == b) is equivalent to a != b
+	negations = map[token.Token]token.Token{token.EQL: token.NEQ, token.NEQ: token.EQL}
+)
+
+func isCommutative(op token.Token) bool {
+	switch op {
+	case token.EQL, token.NEQ, token.MUL, token.AND, token.OR, token.XOR, token.LAND, token.LOR:
+		return true
+	}
+	return false
+}
+
+// isAssociative returns true if operands of a chain of op can be reordered
+// freely. * is not, for floats.
+func isAssociative(op token.Token) bool {
+	switch op {
+	case token.AND, token.OR, token.XOR, token.LAND, token.LOR:
+		return true
+	}
+	return false
+}
+
+func normBinary(x *ast.BinaryExpr) ast.Expr {
+	prec := x.Op.Precedence()
+	b := &ast.BinaryExpr{X: normExpr(x.X, prec), OpPos: x.OpPos, Op: x.Op, Y: normExpr(x.Y, prec+1)}
+
+	if lit, ok := identities[b.Op]; ok {
+		if isLiteral(b.Y, lit) {
+			return b.X
+		} // if
+		if b.Op != token.SUB && b.Op != token.QUO && b.Op != token.SHL && b.Op != token.SHR && isLiteral(b.X, lit) {
+			return unparen(b.Y)
+		} // if
+	} // if
+
+	switch b.Op {
+	case token.GTR, token.GEQ:
+		if !isPure(b.X) || !isPure(b.Y) {
+			return b
+		} // if
+		b.Op = mirrors[b.Op]
+		b.X, b.Y = parenIfNeeded(unparen(b.Y), prec), parenIfNeeded(unparen(b.X), prec+1)
+		return b
+	}
+
+	if !isCommutative(b.Op) {
+		return b
+	} // if
+
+	var operands []ast.Expr
+	if isAssociative(b.Op) {
+		// flatten the left-associated chain
+		for e := ast.Expr(b); ; {
+			be, ok := e.(*ast.BinaryExpr)
+			if !ok || be.Op != b.Op {
+				operands = append(operands, e)
+				break
+			} // if
+			operands = append(operands, be.Y)
+			e = be.X
+		} // for
+	} else {
+		operands = []ast.Expr{b.X, b.Y}
+	} // else
+
+	for _, o := range operands {
+		if !isPure(o) {
+			return b
+		} // if
+	} // for o
+
+	strs := make(map[ast.Expr]string)
+	for _, o := range operands {
+		strs[o] = exprString(unparen(o))
+	} // for o
+	sort.SliceStable(operands, func(i, j int) bool {
+		return strs[operands[i]] < strs[operands[j]]
+	})
+
+	res := parenIfNeeded(unparen(operands[0]), prec)
+	for _, o := range operands[1:] {
+		res = &ast.BinaryExpr{X: res, OpPos: x.OpPos, Op: b.Op, Y: parenIfNeeded(unparen(o), prec+1)}
+	} // for o
+	return res
+}
+
+// sameRawSource returns true if the unnormalized sources of two top level
+// fragments are the same.
+func sameRawSource(orgInfo *fileInfo, orgF diffFragment, newInfo *fileInfo, newF diffFragment) bool {
+	return rawFragment(orgInfo, orgF).calcDiff(rawFragment(newInfo, newF)) == 0
+}
+
+func rawFragment(info *fileInfo, f diffFragment) diffFragment {
+	gRawSource = true
+	defer func() { gRawSource = false }()
+
+	switch nd := f.(*fragment).node.(type) {
+	case *ast.FuncDecl:
+		return newFuncDecl(info.fs, nd)
+	case *ast.GenDecl:
+		return newConstDecl(info.fs, nd)
+	case *ast.ValueSpec:
+		return newVarDecl(info.fs, nd)
+	}
+	return f
+}
@@ -0,0 +1,92 @@
+package godiff
+
+import (
+	"go/parser"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestNormalizeExpr(t *testing.T) {
+	for _, c := range []struct {
+		src, exp string
+	}{
+		{"b == a", "a == b"},
+		{"x + 0", "x"},
+		{"0 + x", "x"},
+		{"x - 0", "x"},
+		{"0 - x", "0 - x"},
+		{"((a))", "a"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"a + (b * c)", "a + b*c"},
+		{"a - (b - c)", "a - (b - c)"},
+		{"c * b * a", "a * (b * c)"},
+		{"c & b & a", "a & b & c"},
+		{"g() == f()", "g() == f()"},
+		{"g() * f()", "g() * f()"},
+		{"f() > x", "f() > x"},
+		{"b > a", "a < b"},
+		{"!!x", "x"},
+		{"-(-x)", "x"},
+		{"!(a == b)", "a != b"},
+		{"y && x", "x && y"},
+		{"f() && x", "f() && x"},
+		{"s + t", "s + t"},
+		{"f((b != a))", "f(a != b)"},
+		{"x == (T{})", "(T{}) == x"},
+	} {
+		e, err := parser.ParseExpr(c.src)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, c.src, exprString(normalizeExpr(e)), c.exp)
+	}
+}
+
+func TestDiff_Normalize(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{Normalize: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func f(a, b int) bool {
+	return a == b && (a > 0)
+}
+
+func g(a int) int {
+	return a + 1
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func f(a, b int) bool {
+	return (0 < a) && b == a
+}
+
+func g(a int) int {
+	return a + 2
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diff(orgInfo, newInfo)
+
+	lines := strings.Split(string(buf), "\n")
+	assert.StringEqual(t, "lines", lines, strings.Split(`~~~ func f(a int, b int) bool { ... } (3 lines) (semantically equivalent)
+    func g(a int) int {
+---     return a + 1
++++     return a + 2
+    }
+`, "\n"))
+}
@@ -0,0 +1,42 @@
+package godiff
+
+import (
+	"path"
+)
+
+// matchOnly returns true if a symbol matches any of gOptions.Only, or there
+// are no patterns. A pattern like "T.*" also matches the type T itself.
+func matchOnly(sym string) bool {
+	if len(gOptions.Only) == 0 {
+		return true
+	} // if
+	for _, pat := range gOptions.Only {
+		if m, _ := path.Match(pat, sym); m {
+			return true
+		} // if
+		if m, _ := path.Match(pat, sym+"."); m {
+			return true
+		} // if
+	} // for pat
+	return false
+}
+
+// selected returns true if a top level fragment declares a symbol matching
+// gOptions.Only.
+func selected(info *fileInfo, f diffFragment) bool {
+	if len(gOptions.Only) == 0 {
+		return true
+	} // if
+	for _, sym := range partSymbols(info, f) {
+		if matchOnly(sym) {
+			return true
+		} // if
+	} // for sym
+	return false
+}
+
+// selectedPair returns true if either of two matched fragments is selected,
+// so that a rename into or out of the patterns is shown.
+func selectedPair(orgInfo *fileInfo, orgF diffFragment, newInfo *fileInfo, newF diffFragment) bool {
+	return selected(orgInfo, orgF) || selected(newInfo, newF)
+}
@@ -0,0 +1,71 @@
+package godiff
+
+import (
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestMatchOnly(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	assert.Equal(t, "no patterns", matchOnly("Any"), true)
+
+	gOptions.Only = []string{"Server.*", "New*"}
+	assert.Equal(t, "method", matchOnly("Server.Start"), true)
+	assert.Equal(t, "type", matchOnly("Server"), true)
+	assert.Equal(t, "func", matchOnly("NewServer"), true)
+	assert.Equal(t, "other type", matchOnly("Client"), false)
+	assert.Equal(t, "other method", matchOnly("Client.Start"), false)
+}
+
+func TestDiffSource_Only(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+
+	org := `package main
+
+import "fmt"
+
+type Server struct{}
+
+func (s *Server) Start() {
+	fmt.Println("start")
+}
+
+func helper() int {
+	return 1
+}
+
+func other() {}
+`
+	nw := `package main
+
+import "os"
+
+type Server struct{}
+
+func (s *Server) Start() {
+	os.Exit(0)
+}
+
+func NewServer() int {
+	return 1
+}
+
+func another() {}
+`
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte(org), "b.go", []byte(nw), &buf,
+		Options{NoColor: true, Only: []string{"Server.*", "New*"}})
+	assert.NoError(t, err)
+	assert.StringEqual(t, "diff", string(buf), `    func (s *Server) Start() {
+---     fmt.Println("start")
++++     os.Exit(0)
+    }
+--- func helper() int {
++++ func NewServer() int {
+        return 1
+    }
+`)
+}
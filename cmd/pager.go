@@ -0,0 +1,223 @@
+package godiff
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+const (
+	// truncMarker ends a truncated line.
+	truncMarker = "…"
+	// wrapMarker starts a continuation line of a wrapped line.
+	wrapMarker = "↪ "
+	// tabWidth is the distance of the tab stops of terminals.
+	tabWidth = 8
+)
+
+// wideRanges are the ranges of East Asian wide and fullwidth runes, which take
+// two columns.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals, symbols and punctuation
+	{0x3041, 0x33FF},   // Kana, Bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK unified ideographs extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x1F300, 0x1F64F}, // pictographs and emoticons
+	{0x1F900, 0x1F9FF}, // supplemental pictographs
+	{0x20000, 0x3FFFD}, // CJK unified ideographs extensions
+}
+
+// nextColumn returns the column after showing c at column w: tabs advance to
+// the next tab stop, wide runes take two columns and combining marks none.
+func nextColumn(w int, c rune) int {
+	switch {
+	case c == '\t':
+		return (w/tabWidth + 1) * tabWidth
+	case unicode.In(c, unicode.Mn, unicode.Me):
+		return w
+	} // switch
+	for _, r := range wideRanges {
+		if c >= r[0] && c <= r[1] {
+			return w + 2
+		} // if
+	} // for r
+	return w + 1
+}
+
+// isTerminal returns true if f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// limitLine truncates, or soft-wraps if wrap is set, a line with ANSI
+// sequences to width columns. Tabs are expanded to spaces. The colors of a
+// wrapped line are restored on the continuation lines, and reset at the ends
+// of the cut lines only if the line has colors.
+func limitLine(line string, width int, wrap bool) []string {
+	if width <= 0 || visibleWidth(line) <= width {
+		return []string{line}
+	} // if
+
+	var lines []string
+	var cur strings.Builder
+	w, limit := 0, width
+	sgr, esc, reset := "", "", ""
+	for _, c := range line {
+		if esc != "" || c == '\x1b' {
+			esc += string(c)
+			if c != '\x1b' && c != '[' && c >= '@' && c <= '~' {
+				cur.WriteString(esc)
+				if c == 'm' {
+					sgr, reset = esc, ansiReset
+				} // if
+				esc = ""
+			} // if
+			continue
+		} // if
+
+		next := nextColumn(w, c)
+		if !wrap && next > limit-1 {
+			// the last column is for the marker
+			cur.WriteString(strings.Repeat(" ", limit-1-w) + truncMarker + reset)
+			return []string{cur.String()}
+		} // if
+		if wrap && next > limit {
+			lines = append(lines, cur.String()+reset)
+			cur.Reset()
+			cur.WriteString(wrapMarker + sgr)
+			w, limit = visibleWidth(wrapMarker), width
+			next = nextColumn(w, c)
+		} // if
+		if c == '\t' {
+			cur.WriteString(strings.Repeat(" ", next-w))
+		} else {
+			cur.WriteRune(c)
+		} // else
+		w = next
+	} // for c
+	return append(lines, cur.String())
+}
+
+// widthWriter limits the lines written to it to a width.
+type widthWriter struct {
+	w     io.Writer
+	width int
+	wrap  bool
+	line  []byte
+}
+
+func (ww *widthWriter) Write(p []byte) (int, error) {
+	ww.line = append(ww.line, p...)
+	for {
+		i := strings.IndexByte(string(ww.line), '\n')
+		if i < 0 {
+			return len(p), nil
+		} // if
+		for _, l := range limitLine(string(ww.line[:i]), ww.width, ww.wrap) {
+			if _, err := io.WriteString(ww.w, l+"\n"); err != nil {
+				return 0, err
+			} // if
+		} // for l
+		ww.line = ww.line[i+1:]
+	} // for
+}
+
+// Flush writes the last line if not ended with a line break.
+func (ww *widthWriter) Flush() error {
+	if len(ww.line) == 0 {
+		return nil
+	} // if
+	_, err := io.WriteString(ww.w, strings.Join(limitLine(string(ww.line), ww.width, ww.wrap), "\n"))
+	ww.line = nil
+	return err
+}
+
+// startPager starts $PAGER, "less -R" by default, writing to stdout. It returns
+// nil if no pager is configured.
+func startPager() (*exec.Cmd, io.WriteCloser, error) {
+	pager := os.Getenv("PAGER")
+	if pager == "" {
+		pager = "less -R"
+	} // if
+	if pager == "cat" {
+		return nil, nil, nil
+	} // if
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if os.Getenv("LESS") == "" {
+		// quit if one screen, keep colors and do not clear the screen, like git
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	} // if
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	} // if
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	} // if
+	return cmd, in, nil
+}
+
+// setupWriter sets up the colors and output of an Exec entry point writing to
+// w. Output to stdout is set up as by Exec, other writers are treated as pipes
+// and get colors, if forced on, as ANSI sequences.
+func setupWriter(w io.Writer, options *Options) (io.Writer, func()) {
+	if w == io.Writer(os.Stdout) {
+		return setupOutput(*options, setupColors(options, isTerminal(os.Stdout)))
+	} // if
+	setupColors(options, false)
+	gANSI = !options.NoColor
+	return w, func() { gANSI = false }
+}
+
+// setupOutput returns the writer of the output to stdout, through the pager
+// and limited to the width as configured, and a function to call when the
+// output is done. Lines are limited only if options.Width or options.Wrap is
+// set. Colors are written as ANSI sequences if ansi or the
+// output is processed.
+func setupOutput(options Options, ansi bool) (w io.Writer, finish func()) {
+	w, finish = os.Stdout, func() {}
+	terminal := isTerminal(os.Stdout)
+	if ansi {
+		gANSI = true
+		finish = func() { gANSI = false }
+	} // if
+
+	width := options.Width
+	if width <= 0 && options.Wrap && terminal {
+		width, _ = terminalSize()
+	} // if
+
+	if terminal && !options.NoPager {
+		if cmd, in, err := startPager(); err == nil && cmd != nil {
+			w, gANSI = in, true
+			finish = func() {
+				in.Close()
+				cmd.Wait()
+				gANSI = false
+			}
+		} // if
+	} // if
+
+	if width > 0 {
+		ww := &widthWriter{w: w, width: width, wrap: options.Wrap}
+		w, gANSI = ww, true
+		prev := finish
+		finish = func() {
+			ww.Flush()
+			prev()
+			gANSI = false
+		}
+	} // if
+	return w, finish
+}
@@ -0,0 +1,44 @@
+package godiff
+
+import (
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestLimitLine(t *testing.T) {
+	assert.StringEqual(t, "short", limitLine("abc", 5, false), []string{"abc"})
+	assert.StringEqual(t, "truncate", limitLine("abcdefgh", 5, false), []string{"abcd…"})
+	assert.StringEqual(t, "truncate color", limitLine("\x1b[31mabcdefgh", 5, false), []string{"\x1b[31mabcd…\x1b[0m"})
+	assert.StringEqual(t, "wrap", limitLine("\x1b[31mabcdefgh", 5, true), []string{
+		"\x1b[31mabcde\x1b[0m",
+		"↪ \x1b[31mfgh",
+	})
+	assert.StringEqual(t, "no limit", limitLine("abcdefgh", -1, false), []string{"abcdefgh"})
+
+	// A tab goes to the next tab stop, wide runes take two columns.
+	assert.StringEqual(t, "tab", limitLine("a\tbcdefgh", 10, false), []string{"a       b…"})
+	assert.StringEqual(t, "tab fits", limitLine("a\tb", 10, false), []string{"a\tb"})
+	assert.StringEqual(t, "wide", limitLine("中文字符", 6, false), []string{"中文 …"})
+	assert.StringEqual(t, "wide wrap", limitLine("中文字符", 5, true), []string{"中文", "↪ 字", "↪ 符"})
+}
+
+func TestNextColumn(t *testing.T) {
+	assert.Equal(t, "a", nextColumn(0, 'a'), 1)
+	assert.Equal(t, "tab", nextColumn(3, '\t'), 8)
+	assert.Equal(t, "tab at stop", nextColumn(8, '\t'), 16)
+	assert.Equal(t, "wide", nextColumn(0, '中'), 2)
+	assert.Equal(t, "fullwidth", nextColumn(0, 'Ａ'), 2)
+	assert.Equal(t, "combining", nextColumn(1, '\u0301'), 1)
+}
+
+func TestWidthWriter(t *testing.T) {
+	var buf bytesp.Slice
+	ww := &widthWriter{w: &buf, width: 4}
+	ww.Write([]byte("ab"))
+	ww.Write([]byte("cdef\nxy\nz"))
+	assert.StringEqual(t, "before flush", string(buf), "abc…\nxy\n")
+	ww.Flush()
+	assert.StringEqual(t, "after flush", string(buf), "abc…\nxy\nz")
+}
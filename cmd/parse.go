@@ -0,0 +1,65 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+
+	"github.com/golangplus/fmt"
+)
+
+// parseErrors returns the errors of parsing as a list with positions.
+func parseErrors(err error) scanner.ErrorList {
+	if el, ok := err.(scanner.ErrorList); ok {
+		return el
+	} // if
+	return scanner.ErrorList{&scanner.Error{Msg: err.Error()}}
+}
+
+// reportParseErrors prints the parse errors of a file into gOut.
+func reportParseErrors(fn string, err error) {
+	for _, e := range parseErrors(err) {
+		if e.Pos.Filename == "" {
+			e.Pos.Filename = fn
+		} // if
+		fmtp.Fprintfln(gOut, "go-diff: %v", e)
+	} // for e
+}
+
+// dropBadDecls removes the declarations of a partially parsed file which
+// contain parse errors, and returns the number of them.
+func dropBadDecls(fs *token.FileSet, f *ast.File, err error) (dropped int) {
+	errs := parseErrors(err)
+	decls := f.Decls[:0]
+	for _, decl := range f.Decls {
+		bad := false
+		if _, ok := decl.(*ast.BadDecl); ok {
+			bad = true
+		} // if
+		start, end := fs.Position(decl.Pos()), fs.Position(decl.End())
+		for _, e := range errs {
+			if e.Pos.Offset >= start.Offset && e.Pos.Offset <= end.Offset {
+				bad = true
+				break
+			} // if
+		} // for e
+		if bad {
+			dropped++
+			continue
+		} // if
+		decls = append(decls, decl)
+	} // for decl
+	f.Decls = decls
+	return dropped
+}
+
+// showBadDecls shows the number of declarations skipped for parse errors, if
+// any.
+func showBadDecls(orgInfo, newInfo *fileInfo) {
+	if orgInfo.badDecls == 0 && newInfo.badDecls == 0 {
+		return
+	} // if
+	showNoteLine(fmt.Sprintf("skipped %d original and %d new declarations with parse errors",
+		orgInfo.badDecls, newInfo.badDecls))
+}
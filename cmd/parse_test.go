@@ -0,0 +1,66 @@
+package godiff
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestParseErrors(t *testing.T) {
+	_, err := parse("a.go", "package main\n\nfunc f( {\n}\n")
+	errs := parseErrors(err)
+	assert.Equal(t, "len(errs) > 0", len(errs) > 0, true)
+	assert.Equal(t, "errs[0].Pos.Line", errs[0].Pos.Line, 3)
+
+	errs = parseErrors(errors.New("failed"))
+	assert.StringEqual(t, "errs", errs.Error(), "failed")
+}
+
+func TestDiff_Partial(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{Partial: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+func a() int {
+	return 1
+}
+
+func b() {
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+func a() int {
+	return 2
+}
+
+func b() {
+	x := 
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "newInfo.parseErr != nil", newInfo.parseErr != nil, true)
+	assert.Equal(t, "newInfo.badDecls", newInfo.badDecls, 1)
+
+	diff(orgInfo, newInfo)
+
+	assert.StringEqual(t, "diff", string(buf), `    func a() int {
+---     return 1
++++     return 2
+    }
+=== func b() { ... } (2 lines)
+::: skipped 0 original and 1 new declarations with parse errors
+`)
+}
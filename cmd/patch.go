@@ -0,0 +1,645 @@
+package godiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// PatchOp is an operation of a semantic patch. Declarations are located by
+// kind, name and signature instead of line numbers.
+type PatchOp struct {
+	// "add", "delete", "replace", "replace-body", "add-field" or
+	// "delete-field"
+	Op string `json:"op"`
+	// "import", "type", "var", "const" or "func"
+	Kind string `json:"kind"`
+	// e.g. "Server.Start" for a method, names joined by commas for a const
+	// block, the name, if any, and the quoted path of an import
+	Name string `json:"name"`
+	// signature of a function, without the names of the receiver and the
+	// parameters
+	Signature string `json:"signature,omitempty"`
+	// name of the field for field operations
+	Field string `json:"field,omitempty"`
+	// source of the declaration, spec, body or field
+	Source string `json:"source,omitempty"`
+}
+
+// Patch is a serializable semantic patch.
+type Patch struct {
+	Ops []PatchOp `json:"ops"`
+}
+
+// funcSignature returns the signature of a function without names.
+func funcSignature(fd *ast.FuncDecl) string {
+	s := "func "
+	if fd.Recv != nil && len(fd.Recv.List) > 0 {
+		s += "(" + exprString(fd.Recv.List[0].Type) + ") "
+	} // if
+	s += fd.Name.Name + "("
+	for i, tp := range fieldTypes(fd.Type.Params) {
+		if i > 0 {
+			s += ", "
+		} // if
+		s += exprString(tp)
+	} // for i, tp
+	s += ")"
+	if results := fieldTypes(fd.Type.Results); len(results) == 1 {
+		s += " " + exprString(results[0])
+	} else if len(results) > 1 {
+		s += " " + typesString(results)
+	} // else if
+	return s
+}
+
+// withKeyword prefixes the first line, which is not a comment, of the source
+// of a spec with the keyword.
+func withKeyword(keyword, src string) string {
+	lines := strings.Split(src, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+			lines[i] = keyword + " " + line
+			break
+		} // if
+	} // for i, line
+	return strings.Join(lines, "\n")
+}
+
+// patchSource returns the source of a unit for a patch: the whole declaration
+// for functions and const blocks, the spec otherwise.
+func patchSource(u *mergeUnit) string {
+	switch {
+	case u.keyword == "func" || u.keyword == "const":
+		return u.text
+	case u.grouped:
+		return dedent(u.text)
+	}
+	return u.specText()
+}
+
+// nodeSource returns the source of a node with its doc and line comments.
+func nodeSource(fs *token.FileSet, src []byte, doc *ast.CommentGroup, node ast.Node, comment *ast.CommentGroup) string {
+	start, end := node.Pos(), node.End()
+	if doc != nil {
+		start = doc.Pos()
+	} // if
+	if comment != nil {
+		end = comment.End()
+	} // if
+	return string(src[fs.Position(start).Offset:fs.Position(end).Offset])
+}
+
+// structFields returns the source of the fields of a struct type spec by
+// names, and the names in order.
+func structFields(mf *mergeFile, ts *ast.TypeSpec) (names []string, fields map[string]string) {
+	st := ts.Type.(*ast.StructType)
+	fields = make(map[string]string)
+	for _, f := range st.Fields.List {
+		name := fieldName(f)
+		names = append(names, name)
+		fields[name] = nodeSource(mf.info.fs, mf.src, f.Doc, f, f.Comment)
+	} // for f
+	return names, fields
+}
+
+// fieldName returns the names of a struct field joined by commas, or the
+// type name of an embedded field.
+func fieldName(f *ast.Field) string {
+	if len(f.Names) == 0 {
+		return embeddedName(f.Type)
+	} // if
+	var names []string
+	for _, name := range f.Names {
+		names = append(names, name.Name)
+	} // for name
+	return strings.Join(names, ",")
+}
+
+// fieldOps returns the field operations changing the struct of org to that of
+// new, or false if other parts changed.
+func fieldOps(orgF *mergeFile, org *ast.TypeSpec, newF *mergeFile, nw *ast.TypeSpec) (ops []PatchOp, ok bool) {
+	if _, ok := org.Type.(*ast.StructType); !ok {
+		return nil, false
+	} // if
+	if _, ok := nw.Type.(*ast.StructType); !ok {
+		return nil, false
+	} // if
+	if org.TypeParams != nil || nw.TypeParams != nil {
+		return nil, false
+	} // if
+	orgNames, orgFields := structFields(orgF, org)
+	newNames, newFields := structFields(newF, nw)
+	name := nw.Name.Name
+	for _, fn := range orgNames {
+		src, ok := newFields[fn]
+		if !ok {
+			ops = append(ops, PatchOp{Op: "delete-field", Kind: "type", Name: name, Field: fn})
+			continue
+		} // if
+		if src != orgFields[fn] {
+			return nil, false
+		} // if
+	} // for fn
+	for _, fn := range newNames {
+		if _, ok := orgFields[fn]; !ok {
+			ops = append(ops, PatchOp{Op: "add-field", Kind: "type", Name: name, Field: fn, Source: newFields[fn]})
+		} // if
+	} // for fn
+	return ops, true
+}
+
+// unitOp returns an operation locating a unit.
+func unitOp(op string, mf *mergeFile, u *mergeUnit) PatchOp {
+	p := PatchOp{Op: op, Kind: u.keyword, Name: symbolsKey(mf.info, u.frag)}
+	if fd, ok := u.frag.(*fragment).node.(*ast.FuncDecl); ok {
+		p.Signature = funcSignature(fd)
+	} // if
+	return p
+}
+
+// importOps returns the operations adding and deleting the imports of org to
+// those of new.
+func importOps(org, nw *mergeFile) (ops []PatchOp) {
+	orgKeys, newKeys := importKeys(org.info.f), importKeys(nw.info.f)
+	for _, imp := range nw.info.f.Imports {
+		if k := importKey(imp); !orgKeys.In(k) {
+			ops = append(ops, PatchOp{Op: "add", Kind: "import", Name: k,
+				Source: nodeSource(nw.info.fs, nw.src, imp.Doc, imp, imp.Comment)})
+		} // if
+	} // for imp
+	for _, imp := range org.info.f.Imports {
+		if k := importKey(imp); !newKeys.In(k) {
+			ops = append(ops, PatchOp{Op: "delete", Kind: "import", Name: k})
+		} // if
+	} // for imp
+	return ops
+}
+
+// importEdits returns the edits of the import operations: deleted imports are
+// removed, with their declaration if no import is left in it, and added ones
+// are inserted in the first import declaration left.
+func importEdits(fs *token.FileSet, src []byte, f *ast.File, ops []PatchOp) ([]patchEdit, error) {
+	off := func(p token.Pos) int {
+		return fs.Position(p).Offset
+	}
+	deleted := make(map[string]bool)
+	var added []string
+	for _, op := range ops {
+		switch op.Op {
+		case "delete":
+			deleted[op.Name] = true
+		case "add":
+			added = append(added, op.Source)
+		default:
+			return nil, fmt.Errorf("import %s: unknown operation %q", op.Name, op.Op)
+		}
+	} // for op
+	existing := importKeys(f)
+	for _, op := range ops {
+		if op.Op == "delete" && !existing.In(op.Name) {
+			return nil, fmt.Errorf("import %s: not found", op.Name)
+		} // if
+		if op.Op == "add" && existing.In(op.Name) && !deleted[op.Name] {
+			return nil, fmt.Errorf("import %s: already exists", op.Name)
+		} // if
+	} // for op
+
+	var edits []patchEdit
+	var kept *ast.GenDecl
+	for _, d := range importDecls(f) {
+		var removed []*ast.ImportSpec
+		for _, spec := range d.Specs {
+			if imp := spec.(*ast.ImportSpec); deleted[importKey(imp)] {
+				removed = append(removed, imp)
+			} // if
+		} // for spec
+		if len(removed) == len(d.Specs) {
+			start, end := d.Pos(), d.End()
+			if d.Doc != nil {
+				start = d.Doc.Pos()
+			} // if
+			s, e := lineRange(src, off(start), off(end))
+			edits = append(edits, patchEdit{s, e, ""})
+			continue
+		} // if
+		if kept == nil {
+			kept = d
+		} // if
+		for _, imp := range removed {
+			start, end := imp.Pos(), imp.End()
+			if imp.Doc != nil {
+				start = imp.Doc.Pos()
+			} // if
+			if imp.Comment != nil {
+				end = imp.Comment.End()
+			} // if
+			s, e := lineRange(src, off(start), off(end))
+			edits = append(edits, patchEdit{s, e, ""})
+		} // for imp
+	} // for d
+	if len(added) == 0 {
+		return edits, nil
+	} // if
+
+	switch {
+	case kept == nil && len(added) == 1:
+		at := lineEnd(src, off(f.Name.End()))
+		edits = append(edits, patchEdit{at, at, "\n\nimport " + added[0]})
+	case kept == nil:
+		at := lineEnd(src, off(f.Name.End()))
+		edits = append(edits, patchEdit{at, at, "\n\nimport (\n" + strings.Join(added, "\n") + "\n)"})
+	case kept.Lparen.IsValid():
+		at := off(kept.Rparen)
+		edits = append(edits, patchEdit{at, at, strings.Join(added, "\n") + "\n"})
+	default:
+		at := lineEnd(src, off(kept.End()))
+		edits = append(edits, patchEdit{at, at, "\nimport " + strings.Join(added, "\nimport ")})
+	}
+	return edits, nil
+}
+
+// MakePatch returns the semantic patch changing the declarations of org into
+// those of new.
+func MakePatch(orgSrc, newSrc []byte) (*Patch, error) {
+	defer func(options Options) { gOptions = options }(gOptions)
+	gOptions = Options{}
+
+	org, err := parseMergeFile("org", orgSrc)
+	if err != nil {
+		return nil, err
+	} // if
+	nw, err := parseMergeFile("new", newSrc)
+	if err != nil {
+		return nil, err
+	} // if
+	matchBase(org, nw)
+
+	matched := make(map[*mergeUnit]bool)
+	for _, u := range nw.units {
+		if u.base != nil {
+			matched[u.base] = true
+		} // if
+	} // for u
+	// Pair the declarations left unmatched, e.g. a var with only its value
+	// changed, by kind and name.
+	byName := make(map[string]*mergeUnit)
+	for _, u := range org.units {
+		if u.frag != nil && !matched[u] {
+			byName[u.keyword+" "+symbolsKey(org.info, u.frag)] = u
+		} // if
+	} // for u
+	for _, u := range nw.units {
+		if u.frag == nil || u.base != nil {
+			continue
+		} // if
+		key := u.keyword + " " + symbolsKey(nw.info, u.frag)
+		if ou := byName[key]; ou != nil {
+			u.base, matched[ou] = ou, true
+			delete(byName, key)
+		} // if
+	} // for u
+
+	patch := &Patch{Ops: importOps(org, nw)}
+	for _, u := range nw.units {
+		if u.frag == nil {
+			continue
+		} // if
+		if u.base == nil {
+			op := unitOp("add", nw, u)
+			op.Source = patchSource(u)
+			patch.Ops = append(patch.Ops, op)
+			continue
+		} // if
+		if u.key() == u.base.key() {
+			continue
+		} // if
+
+		orgNode, newNode := u.base.frag.(*fragment).node, u.frag.(*fragment).node
+		op := unitOp("replace", org, u.base)
+		switch nd := newNode.(type) {
+		case *ast.FuncDecl:
+			od := orgNode.(*ast.FuncDecl)
+			if nd.Body != nil && od.Body != nil && funcSignature(od) == funcSignature(nd) &&
+				nodeSource(org.info.fs, org.src, od.Doc, od.Type, nil) == nodeSource(nw.info.fs, nw.src, nd.Doc, nd.Type, nil) {
+				op.Op, op.Source = "replace-body", nodeSource(nw.info.fs, nw.src, nil, nd.Body, nil)
+				patch.Ops = append(patch.Ops, op)
+				continue
+			} // if
+		case *ast.TypeSpec:
+			if ots, ok := orgNode.(*ast.TypeSpec); ok && ots.Name.Name == nd.Name.Name {
+				if ops, ok := fieldOps(org, ots, nw, nd); ok {
+					patch.Ops = append(patch.Ops, ops...)
+					continue
+				} // if
+			} // if
+		}
+		op.Source = patchSource(u)
+		patch.Ops = append(patch.Ops, op)
+	} // for u
+	for _, u := range org.units {
+		if u.frag != nil && !matched[u] {
+			patch.Ops = append(patch.Ops, unitOp("delete", org, u))
+		} // if
+	} // for u
+	return patch, nil
+}
+
+// patchTarget is a declaration in the file a patch is applied to.
+type patchTarget struct {
+	kind, name, signature string
+	node                  ast.Node
+	// start and end are the offsets of the declaration or spec including
+	// comments.
+	start, end int
+	grouped    bool
+}
+
+func collectTargets(fs *token.FileSet, src []byte, f *ast.File) (targets []*patchTarget) {
+	off := func(p token.Pos) int {
+		return fs.Position(p).Offset
+	}
+	add := func(kind, name, sig string, node ast.Node, doc *ast.CommentGroup, start, end token.Pos, grouped bool) {
+		if doc != nil {
+			start = doc.Pos()
+		} // if
+		targets = append(targets, &patchTarget{kind: kind, name: name, signature: sig, node: node,
+			start: off(start), end: off(end), grouped: grouped})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			add("func", funcSymbol(d), funcSignature(d), d, d.Doc, d.Pos(), d.End(), false)
+		case *ast.GenDecl:
+			switch d.Tok {
+			case token.CONST:
+				var names []string
+				for _, spec := range d.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						names = append(names, name.Name)
+					} // for name
+				} // for spec
+				sort.Strings(names)
+				add("const", strings.Join(names, ","), "", d, d.Doc, d.Pos(), d.End(), false)
+			case token.TYPE, token.VAR:
+				grouped := d.Lparen.IsValid()
+				for _, spec := range d.Specs {
+					start, end, doc := spec.Pos(), spec.End(), d.Doc
+					var comment *ast.CommentGroup
+					var names []string
+					switch sp := spec.(type) {
+					case *ast.TypeSpec:
+						names, comment = []string{sp.Name.Name}, sp.Comment
+						if grouped {
+							doc = sp.Doc
+						} // if
+					case *ast.ValueSpec:
+						for _, name := range sp.Names {
+							names = append(names, name.Name)
+						} // for name
+						sort.Strings(names)
+						comment = sp.Comment
+						if grouped {
+							doc = sp.Doc
+						} // if
+					}
+					if !grouped {
+						start, end = d.Pos(), d.End()
+					} // if
+					if comment != nil {
+						end = comment.End()
+					} // if
+					add(d.Tok.String(), strings.Join(names, ","), "", spec, doc, start, end, grouped)
+				} // for spec
+			}
+		}
+	} // for decl
+	return targets
+}
+
+// locate returns the target of an operation, preferring the one with the
+// same signature.
+func locate(targets []*patchTarget, op PatchOp) (found *patchTarget) {
+	for _, t := range targets {
+		if t.kind != op.Kind || t.name != op.Name {
+			continue
+		} // if
+		if t.signature == op.Signature {
+			return t
+		} // if
+		if found == nil {
+			found = t
+		} // if
+	} // for t
+	return found
+}
+
+// patchEdit replaces the source from start to end with text.
+type patchEdit struct {
+	start, end int
+	text       string
+}
+
+// lineRange extends a range to whole lines, including the line break.
+func lineRange(src []byte, start, end int) (int, int) {
+	for start > 0 && (src[start-1] == ' ' || src[start-1] == '\t') {
+		start--
+	} // for
+	end = lineEnd(src, end)
+	if end < len(src) {
+		end++
+	} // if
+	return start, end
+}
+
+// ApplyPatch applies a semantic patch to the source of a file and returns the
+// source re-printed by go/printer. Declarations are located by kind, name and
+// signature so the file may have drifted from the one the patch was made
+// against.
+func ApplyPatch(patch *Patch, src []byte) ([]byte, error) {
+	fs := token.NewFileSet()
+	f, err := parser.ParseFile(fs, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	} // if
+	targets := collectTargets(fs, src, f)
+
+	// Apply deletes first so that a declaration may be deleted and added back.
+	ops := append([]PatchOp(nil), patch.Ops...)
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Op == "delete" && ops[j].Op != "delete"
+	})
+	var importOps []PatchOp
+	for _, op := range ops {
+		if op.Kind == "import" {
+			importOps = append(importOps, op)
+		} // if
+	} // for op
+	edits, err := importEdits(fs, src, f, importOps)
+	if err != nil {
+		return nil, err
+	} // if
+
+	deleted := make(map[*patchTarget]bool)
+	var appends []string
+	for _, op := range ops {
+		if op.Kind == "import" {
+			continue
+		} // if
+		t := locate(targets, op)
+		what := op.Kind + " " + op.Name
+		switch op.Op {
+		case "add":
+			if t != nil && !deleted[t] {
+				return nil, fmt.Errorf("%s: already exists", what)
+			} // if
+			s := op.Source
+			if op.Kind == "type" || op.Kind == "var" {
+				s = withKeyword(op.Kind, s)
+			} // if
+			appends = append(appends, s)
+			continue
+		case "delete", "replace", "replace-body", "add-field", "delete-field":
+			if t == nil {
+				return nil, fmt.Errorf("%s: not found", what)
+			} // if
+		default:
+			return nil, fmt.Errorf("%s: unknown operation %q", what, op.Op)
+		}
+
+		switch op.Op {
+		case "delete":
+			deleted[t] = true
+			start, end := lineRange(src, t.start, t.end)
+			edits = append(edits, patchEdit{start, end, ""})
+		case "replace":
+			s := op.Source
+			if (op.Kind == "type" || op.Kind == "var") && !t.grouped {
+				s = withKeyword(op.Kind, s)
+			} // if
+			edits = append(edits, patchEdit{t.start, t.end, s})
+		case "replace-body":
+			fd := t.node.(*ast.FuncDecl)
+			if op.Signature != "" && t.signature != op.Signature {
+				return nil, fmt.Errorf("%s: signature changed from %s to %s", what, op.Signature, t.signature)
+			} // if
+			if fd.Body == nil {
+				return nil, fmt.Errorf("%s: no body", what)
+			} // if
+			edits = append(edits, patchEdit{fs.Position(fd.Body.Pos()).Offset, fs.Position(fd.Body.End()).Offset, op.Source})
+		case "add-field", "delete-field":
+			ts, ok := t.node.(*ast.TypeSpec)
+			if !ok {
+				return nil, fmt.Errorf("%s: not a struct", what)
+			} // if
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				return nil, fmt.Errorf("%s: not a struct", what)
+			} // if
+			var field *ast.Field
+			for _, fld := range st.Fields.List {
+				if fieldName(fld) == op.Field {
+					field = fld
+				} // if
+			} // for fld
+			if op.Op == "add-field" {
+				if field != nil {
+					return nil, fmt.Errorf("%s: field %s already exists", what, op.Field)
+				} // if
+				// Insert at the line of the closing brace, or before it if it
+				// is not on its own line.
+				at := fs.Position(st.Fields.Closing).Offset
+				for at > 0 && (src[at-1] == ' ' || src[at-1] == '\t') {
+					at--
+				} // for
+				text := op.Source + "\n"
+				if at == 0 || src[at-1] != '\n' {
+					at, text = fs.Position(st.Fields.Closing).Offset, "\n"+text
+				} // if
+				edits = append(edits, patchEdit{at, at, text})
+				break
+			} // if
+			if field == nil {
+				return nil, fmt.Errorf("%s: field %s not found", what, op.Field)
+			} // if
+			start, end := field.Pos(), field.End()
+			if field.Doc != nil {
+				start = field.Doc.Pos()
+			} // if
+			if field.Comment != nil {
+				end = field.Comment.End()
+			} // if
+			s, e := lineRange(src, fs.Position(start).Offset, fs.Position(end).Offset)
+			edits = append(edits, patchEdit{s, e, ""})
+		}
+	} // for op
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	out := append([]byte(nil), src...)
+	for i, e := range edits {
+		if i > 0 && e.end > edits[i-1].start {
+			return nil, fmt.Errorf("overlapping changes at offset %d", e.start)
+		} // if
+		out = append(out[:e.start:e.start], append([]byte(e.text), out[e.end:]...)...)
+	} // for i, e
+	for _, s := range appends {
+		out = append(bytes.TrimRight(out, "\n"), []byte("\n\n"+s+"\n")...)
+	} // for s
+	return format.Source(out)
+}
+
+// ExecPatch prints the semantic patch between two files in JSON into w.
+func ExecPatch(orgFn, newFn string, w io.Writer) error {
+	if err := checkStdin(orgFn, newFn); err != nil {
+		return err
+	} // if
+	orgSrc, err := readSource(orgFn)
+	if err != nil {
+		return err
+	} // if
+	newSrc, err := readSource(newFn)
+	if err != nil {
+		return err
+	} // if
+	patch, err := MakePatch(orgSrc, newSrc)
+	if err != nil {
+		return err
+	} // if
+	bs, err := json.MarshalIndent(patch, "", "  ")
+	if err != nil {
+		return err
+	} // if
+	_, err = fmt.Fprintln(w, string(bs))
+	return err
+}
+
+// ExecApply applies the semantic patch in file patchFn to file fn in place.
+func ExecApply(patchFn, fn string) error {
+	bs, err := readSource(patchFn)
+	if err != nil {
+		return err
+	} // if
+	var patch Patch
+	if err := json.Unmarshal(bs, &patch); err != nil {
+		return fmt.Errorf("%s: %v", patchFn, err)
+	} // if
+	src, err := readSource(fn)
+	if err != nil {
+		return err
+	} // if
+	out, err := ApplyPatch(&patch, src)
+	if err != nil {
+		return fmt.Errorf("%s: %v", fn, err)
+	} // if
+	return ioutil.WriteFile(fn, out, 0644)
+}
@@ -0,0 +1,148 @@
+package godiff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golangplus/testing/assert"
+)
+
+const patchOrg = `package main
+
+type S struct {
+	A int
+}
+
+func (s *S) M() int {
+	return s.A
+}
+
+func old() {
+}
+`
+
+const patchNew = `package main
+
+type S struct {
+	A int
+	// B is new.
+	B string
+}
+
+func (s *S) M() int {
+	return s.A + 1
+}
+
+// X is added.
+func X() {
+}
+`
+
+func TestMakePatch(t *testing.T) {
+	patch, err := MakePatch([]byte(patchOrg), []byte(patchNew))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.StringEqual(t, "ops", patch.Ops, []PatchOp{
+		{Op: "add-field", Kind: "type", Name: "S", Field: "B", Source: "// B is new.\n\tB string"},
+		{Op: "replace-body", Kind: "func", Name: "S.M", Signature: "func (*S) M() int", Source: "{\n\treturn s.A + 1\n}"},
+		{Op: "add", Kind: "func", Name: "X", Signature: "func X()", Source: "// X is added.\nfunc X() {\n}"},
+		{Op: "delete", Kind: "func", Name: "old", Signature: "func old()"},
+	})
+
+	// The patch survives serialization.
+	bs, err := json.Marshal(patch)
+	assert.NoError(t, err)
+	var p Patch
+	assert.NoError(t, json.Unmarshal(bs, &p))
+	assert.StringEqual(t, "ops", p.Ops, patch.Ops)
+}
+
+func TestApplyPatch_Drifted(t *testing.T) {
+	patch, err := MakePatch([]byte(patchOrg), []byte(patchNew))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The target has reordered declarations and unrelated changes.
+	out, err := ApplyPatch(patch, []byte(`package main
+
+import "fmt"
+
+func old() {
+}
+
+// M returns A.
+func (s *S) M() int {
+	return s.A
+}
+
+type S struct {
+	A int
+	C bool // C is local.
+}
+
+func Y() { fmt.Println() }
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.StringEqual(t, "out", string(out), `package main
+
+import "fmt"
+
+// M returns A.
+func (s *S) M() int {
+	return s.A + 1
+}
+
+type S struct {
+	A int
+	C bool // C is local.
+	// B is new.
+	B string
+}
+
+func Y() { fmt.Println() }
+
+// X is added.
+func X() {
+}
+`)
+}
+
+func TestApplyPatch_Errors(t *testing.T) {
+	_, err := ApplyPatch(&Patch{Ops: []PatchOp{{Op: "delete", Kind: "func", Name: "missing"}}}, []byte("package main\n"))
+	assert.Equal(t, "not found", err != nil, true)
+
+	_, err = ApplyPatch(&Patch{Ops: []PatchOp{{Op: "replace-body", Kind: "func", Name: "f", Signature: "func f()", Source: "{}"}}},
+		[]byte("package main\n\nfunc f(a int) {\n}\n"))
+	assert.Equal(t, "signature changed", err != nil, true)
+}
+
+func TestApplyPatch_RoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		org, new string
+	}{
+		{patchOrg, patchNew},
+		{"package main\n\nvar x = 1\n", "package main\n\nvar x = 2\n"},
+		{"package main\n\nconst C = 1\n", "package main\n\nconst C = 2\n"},
+		{"package main\n\nvar (\n\tx = 1\n\ty = \"a\"\n)\n", "package main\n\nvar (\n\tx = 2\n\ty = \"a\"\n)\n"},
+	
+		// imports added and deleted
+		{"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println()\n}\n",
+			"package main\n\nimport \"os\"\n\nfunc main() {\n\tos.Exit(1)\n}\n"},
+		{"package main\n\nimport (\n\t\"fmt\" // printing\n\t\"strings\"\n)\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+			"package main\n\nimport (\n\t\"fmt\" // printing\n\t\"os\"\n)\n\nfunc main() {\n\tfmt.Println(os.Args)\n}\n"},
+		{"package main\n\nfunc main() {\n}\n", "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() {\n\tfmt.Println(os.Args)\n}\n"},
+	} {
+		patch, err := MakePatch([]byte(c.org), []byte(c.new))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		out, err := ApplyPatch(patch, []byte(c.org))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.StringEqual(t, "applied", string(out), c.new)
+	} // for c
+}
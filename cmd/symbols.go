@@ -0,0 +1,230 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/daviddengcn/go-villa"
+)
+
+// funcSymbol returns the symbol of a function, e.g. "Server.Start" for a
+// method.
+func funcSymbol(fd *ast.FuncDecl) string {
+	if fd.Recv == nil || len(fd.Recv.List) == 0 {
+		return fd.Name.Name
+	} // if
+	recv, _ := recvTypeName(fd)
+	return recv + "." + fd.Name.Name
+}
+
+// partSymbols returns the symbols declared by a top level fragment.
+func partSymbols(info *fileInfo, f diffFragment) (syms []string) {
+	switch nd := f.(*fragment).node.(type) {
+	case *ast.TypeSpec:
+		return []string{nd.Name.Name}
+	case *ast.FuncDecl:
+		return []string{funcSymbol(nd)}
+	case *ast.ValueSpec:
+		for _, name := range nd.Names {
+			syms = append(syms, name.Name)
+		} // for name
+	case *ast.GenDecl:
+		for _, cd := range info.consts.byDecl[nd] {
+			syms = append(syms, cd.name)
+		} // for cd
+	}
+	return syms
+}
+
+// changedConsts returns the names of constants changed between two matched
+// const blocks.
+func changedConsts(orgInfo *fileInfo, orgD *ast.GenDecl, newInfo *fileInfo, newD *ast.GenDecl) (syms []string) {
+	key := func(cd *constDef) string {
+		k := exprString(cd.expr) + "=" + constValueString(cd.value)
+		if cd.tp != nil {
+			k += " " + exprString(cd.tp)
+		} // if
+		return k
+	}
+	orgKeys, newKeys := make(map[string]string), make(map[string]string)
+	for _, cd := range orgInfo.consts.byDecl[orgD] {
+		orgKeys[cd.name] = key(cd)
+	} // for cd
+	for _, cd := range newInfo.consts.byDecl[newD] {
+		newKeys[cd.name] = key(cd)
+		if k, ok := orgKeys[cd.name]; !ok || k != newKeys[cd.name] {
+			syms = append(syms, cd.name)
+		} // if
+	} // for cd
+	for name := range orgKeys {
+		if _, ok := newKeys[name]; !ok {
+			syms = append(syms, name)
+		} // if
+	} // for name
+	return syms
+}
+
+// changedSymbols returns the symbols of modified, added or removed
+// declarations.
+func changedSymbols(orgInfo, newInfo *fileInfo) villa.StrSet {
+	syms := villa.NewStrSet()
+	for _, parts := range [][2]*fragment{
+		{orgInfo.types, newInfo.types},
+		{orgInfo.vars, newInfo.vars},
+		{orgInfo.funcs, newInfo.funcs},
+	} {
+		orgParts, newParts := parts[0].Parts, parts[1].Parts
+		mat, matA, matB := matchParts(orgParts, newParts)
+		for i, j := range matA {
+			if j < 0 {
+				syms.Put(partSymbols(orgInfo, orgParts[i])...)
+				continue
+			} // if
+			if mat[i][j] == 0 {
+				continue
+			} // if
+			orgD, ok1 := orgParts[i].(*fragment).node.(*ast.GenDecl)
+			newD, ok2 := newParts[j].(*fragment).node.(*ast.GenDecl)
+			if ok1 && ok2 {
+				syms.Put(changedConsts(orgInfo, orgD, newInfo, newD)...)
+				continue
+			} // if
+			syms.Put(partSymbols(orgInfo, orgParts[i])...)
+			syms.Put(partSymbols(newInfo, newParts[j])...)
+		} // for i, j
+		for j, i := range matB {
+			if i < 0 {
+				syms.Put(partSymbols(newInfo, newParts[j])...)
+			} // if
+		} // for j, i
+	} // for parts
+	return syms
+}
+
+// importNames returns the names of imported packages used in a file.
+func importNames(f *ast.File) villa.StrSet {
+	names := villa.NewStrSet()
+	for _, imp := range f.Imports {
+		if imp.Name != nil {
+			names.Put(imp.Name.Name)
+			continue
+		} // if
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			names.Put(path.Base(p))
+		} // if
+	} // for imp
+	return names
+}
+
+// funcRefs returns the names referenced in the body of a function. A selected
+// name, e.g. a method, is prefixed with a ".". Names selected from imported
+// packages are excluded.
+func funcRefs(fd *ast.FuncDecl, imports villa.StrSet) villa.StrSet {
+	refs := villa.NewStrSet()
+	if fd.Body == nil {
+		return refs
+	} // if
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch nd := n.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := nd.X.(*ast.Ident); ok && imports.In(id.Name) {
+				return false
+			} // if
+			refs.Put("." + nd.Sel.Name)
+			ast.Inspect(nd.X, visit)
+			return false
+		case *ast.Ident:
+			refs.Put(nd.Name)
+		}
+		return true
+	}
+	ast.Inspect(fd.Body, visit)
+	return refs
+}
+
+// symbolRef returns how a symbol is referenced, i.e. methods by their selected
+// names.
+func symbolRef(sym string) string {
+	for i := len(sym) - 1; i >= 0; i-- {
+		if sym[i] == '.' {
+			return sym[i:]
+		} // if
+	} // for i
+	return sym
+}
+
+// expandCallers adds to syms, transitively, the functions of either file
+// referencing any of syms.
+func expandCallers(orgInfo, newInfo *fileInfo, syms villa.StrSet) {
+	type caller struct {
+		sym  string
+		refs villa.StrSet
+	}
+	var callers []caller
+	for _, info := range []*fileInfo{orgInfo, newInfo} {
+		imports := importNames(info.f)
+		for _, p := range info.funcs.Parts {
+			if fd, ok := p.(*fragment).node.(*ast.FuncDecl); ok {
+				callers = append(callers, caller{sym: funcSymbol(fd), refs: funcRefs(fd, imports)})
+			} // if
+		} // for p
+	} // for info
+
+	for changed := true; changed; {
+		changed = false
+		refs := villa.NewStrSet()
+		for sym := range syms {
+			refs.Put(symbolRef(sym))
+		} // for sym
+		for _, c := range callers {
+			if syms.In(c.sym) {
+				continue
+			} // if
+			for ref := range c.refs {
+				if refs.In(ref) {
+					syms.Put(c.sym)
+					changed = true
+					break
+				} // if
+			} // for ref
+		} // for c
+	} // for
+}
+
+// packageName returns the package name of the files, preferring the new one.
+func packageName(orgInfo, newInfo *fileInfo) string {
+	if newInfo.f.Name != nil {
+		return newInfo.f.Name.Name
+	} // if
+	if orgInfo.f.Name != nil {
+		return orgInfo.f.Name.Name
+	} // if
+	return ""
+}
+
+// diffSymbols prints the fully qualified names of changed declarations, one
+// per line.
+func diffSymbols(orgInfo, newInfo *fileInfo) {
+	syms := changedSymbols(orgInfo, newInfo)
+	if gOptions.SymbolCallers {
+		expandCallers(orgInfo, newInfo, syms)
+	} // if
+
+	names := make([]string, 0, len(syms))
+	for sym := range syms {
+		if sym != "_" {
+			names = append(names, sym)
+		} // if
+	} // for sym
+	sort.Strings(names)
+
+	pkg := packageName(orgInfo, newInfo)
+	for _, name := range names {
+		fmt.Fprintln(gOut, cat(pkg, ".", name))
+	} // for name
+	gDiffs += len(names)
+}
@@ -0,0 +1,90 @@
+package godiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+const symbolsOrg = `
+package lib
+
+import "fmt"
+
+type Server struct{}
+
+const (
+	A = iota
+	B
+)
+
+func (s *Server) Start() { s.listen() }
+
+func (s *Server) listen() { fmt.Println(A) }
+
+func Run() { new(Server).Start() }
+
+func TestRun(t *testing.T) { Run() }
+
+func TestOther(t *testing.T) {}
+`
+
+const symbolsNew = `
+package lib
+
+import "fmt"
+
+type Server struct{}
+
+const (
+	A = iota
+	B = 5
+)
+
+func (s *Server) Start() { s.listen() }
+
+func (s *Server) listen() { fmt.Println(A, "listening") }
+
+func Run() { new(Server).Start() }
+
+func TestRun(t *testing.T) { Run() }
+
+func TestOther(t *testing.T) {}
+
+func Added() {}
+`
+
+func TestDiffSymbols(t *testing.T) {
+	orgInfo, err := parse("", symbolsOrg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", symbolsNew)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytesp.Slice
+	gOut = &buf
+	diffSymbols(orgInfo, newInfo)
+	assert.StringEqual(t, "symbols", strings.Split(string(buf), "\n"), strings.Split(
+		`lib.Added
+lib.B
+lib.Server.listen
+`, "\n"))
+
+	buf = nil
+	gOptions = Options{SymbolCallers: true}
+	defer func() { gOptions = Options{} }()
+	diffSymbols(orgInfo, newInfo)
+	assert.StringEqual(t, "symbols", strings.Split(string(buf), "\n"), strings.Split(
+		`lib.Added
+lib.B
+lib.Run
+lib.Server.Start
+lib.Server.listen
+lib.TestRun
+`, "\n"))
+}
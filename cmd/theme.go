@@ -0,0 +1,227 @@
+package godiff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/daviddengcn/go-colortext"
+)
+
+// Kinds of text shown with a style.
+const (
+	st_DEL       = iota // deleted lines
+	st_INS              // inserted lines
+	st_DEL_TOKEN        // changed tokens in deleted lines
+	st_INS_TOKEN        // changed tokens in inserted lines
+	st_MAT              // matched tokens in deleted lines
+	st_FLD              // folded lines and notes
+	st_WARN             // warnings
+	st_COUNT
+)
+
+// textStyle is how a kind of text is shown. The console colors are used with
+// 16 colors, the palette and RGB colors, if not empty, with 256 and 24-bit
+// colors respectively.
+type textStyle struct {
+	fg       ct.Color
+	fgBright bool
+	bg       ct.Color
+
+	fg256, bg256 string // palette indexes
+	fgRGB, bgRGB string // "r;g;b"
+	attrs        string // SGR attributes, e.g. "1" for bold
+}
+
+type theme [st_COUNT]textStyle
+
+var themes = map[string]*theme{
+	"default": {
+		st_DEL:       {fg: ct.Red},
+		st_INS:       {fg: ct.Green},
+		st_DEL_TOKEN: {fg: ct.Red, fgBright: true, bg256: "52", bgRGB: "94;16;16"},
+		st_INS_TOKEN: {fg: ct.Green, fgBright: true, bg256: "22", bgRGB: "16;72;16"},
+		st_MAT:       {fg: ct.White},
+		st_FLD:       {fg: ct.Yellow},
+		st_WARN:      {fg: ct.Yellow, fgBright: true},
+	},
+	// Dark colors and no white, readable on light backgrounds.
+	"light": {
+		st_DEL:       {fg: ct.Red, fg256: "124", fgRGB: "175;0;0"},
+		st_INS:       {fg: ct.Green, fg256: "28", fgRGB: "0;115;0"},
+		st_DEL_TOKEN: {fg: ct.Red, fg256: "124", bg256: "224", fgRGB: "175;0;0", bgRGB: "255;215;215"},
+		st_INS_TOKEN: {fg: ct.Green, fg256: "28", bg256: "194", fgRGB: "0;115;0", bgRGB: "215;255;215"},
+		st_MAT:       {},
+		st_FLD:       {fg: ct.Blue, fg256: "130", fgRGB: "175;95;0"},
+		st_WARN:      {fg: ct.Magenta, fg256: "124", fgRGB: "175;0;95", attrs: "1"},
+	},
+	// Orange and blue instead of red and green.
+	"colorblind": {
+		st_DEL:       {fg: ct.Yellow, fg256: "208", fgRGB: "230;159;0"},
+		st_INS:       {fg: ct.Cyan, fg256: "32", fgRGB: "86;180;233"},
+		st_DEL_TOKEN: {fg: ct.Yellow, fgBright: true, fg256: "208", bg256: "94", fgRGB: "230;159;0", bgRGB: "90;60;0"},
+		st_INS_TOKEN: {fg: ct.Cyan, fgBright: true, fg256: "32", bg256: "23", fgRGB: "86;180;233", bgRGB: "0;55;95"},
+		st_MAT:       {},
+		st_FLD:       {fg: ct.Magenta},
+		st_WARN:      {fg: ct.Magenta, fgBright: true, attrs: "1"},
+	},
+	// No colors, only attributes.
+	"mono": {
+		st_DEL:       {attrs: "2"},
+		st_INS:       {attrs: "1"},
+		st_DEL_TOKEN: {attrs: "9;4"},
+		st_INS_TOKEN: {attrs: "1;4"},
+		st_MAT:       {attrs: "2"},
+		st_FLD:       {attrs: "3"},
+		st_WARN:      {attrs: "1;7"},
+	},
+}
+
+// ThemeNames returns the sorted names of the color themes.
+func ThemeNames() []string {
+	var names []string
+	for name := range themes {
+		names = append(names, name)
+	} // for name
+	sort.Strings(names)
+	return names
+}
+
+func currentTheme() *theme {
+	if t, ok := themes[gOptions.Theme]; ok {
+		return t
+	} // if
+	return themes["default"]
+}
+
+// colorDepth returns the number of colors to use, 16, 256 or 24 for 24-bit
+// colors.
+func colorDepth() int {
+	if gOptions.Colors == 0 {
+		return 16
+	} // if
+	return gOptions.Colors
+}
+
+// detectColors returns the number of colors of the terminal from $COLORTERM
+// and $TERM.
+func detectColors() int {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return 24
+	} // switch
+	if strings.Contains(os.Getenv("TERM"), "256color") {
+		return 256
+	} // if
+	return 16
+}
+
+// colorOff returns whether colors are turned off, given the -no-color
+// option. NO_COLOR turns colors off and FORCE_COLOR on, else they are on for
+// terminals only.
+func colorOff(noColor, terminal bool) bool {
+	if noColor {
+		return true
+	} // if
+	switch os.Getenv("FORCE_COLOR") {
+	case "", "0", "false":
+	default:
+		return false
+	} // switch
+	if os.Getenv("NO_COLOR") != "" {
+		return true
+	} // if
+	return !terminal
+}
+
+// setupColors decides the colors of an Exec entry point writing to a
+// terminal, or a pipe if terminal is false, from the environment. It returns
+// true if the colors are to be written as ANSI sequences, i.e. they can not be
+// shown by changing the console colors.
+func setupColors(options *Options, terminal bool) (ansi bool) {
+	options.NoColor = colorOff(options.NoColor, terminal)
+	if options.NoColor {
+		return false
+	} // if
+	if options.Colors == 0 {
+		options.Colors = detectColors()
+	} // if
+	t, ok := themes[options.Theme]
+	if !ok {
+		t = themes["default"]
+	} // if
+	return !terminal || t.needsANSI(options.Colors)
+}
+
+// needsANSI returns whether the style can only be shown with ANSI sequences.
+func (st *textStyle) needsANSI(depth int) bool {
+	return st.attrs != "" || depth >= 256 && (st.fg256 != "" || st.bg256 != "") ||
+		depth == 24 && (st.fgRGB != "" || st.bgRGB != "")
+}
+
+// needsANSI returns whether any style of the theme can only be shown with ANSI
+// sequences.
+func (t *theme) needsANSI(depth int) bool {
+	for i := range t {
+		if t[i].needsANSI(depth) {
+			return true
+		} // if
+	} // for i
+	return false
+}
+
+// ansi returns the ANSI sequence showing the style. The sequence resets the
+// previous style first so that backgrounds and attributes do not leak.
+func (st *textStyle) ansi(depth int) string {
+	codes := []string{"0"}
+	if st.attrs != "" {
+		codes = append(codes, st.attrs)
+	} // if
+	switch {
+	case depth == 24 && st.fgRGB != "":
+		codes = append(codes, "38;2;"+st.fgRGB)
+	case depth >= 256 && st.fg256 != "":
+		codes = append(codes, "38;5;"+st.fg256)
+	case st.fg != ct.None:
+		codes = append(codes, strings.TrimSuffix(ansiColor(st.fg, st.fgBright, ct.None, false)[2:], "m"))
+	} // switch
+	switch {
+	case depth == 24 && st.bgRGB != "":
+		codes = append(codes, "48;2;"+st.bgRGB)
+	case depth >= 256 && st.bg256 != "":
+		codes = append(codes, "48;5;"+st.bg256)
+	case st.bg != ct.None:
+		codes = append(codes, strings.TrimSuffix(ansiColor(ct.None, false, st.bg, false)[2:], "m"))
+	} // switch
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// consoleColors returns whether colors can be shown by changing the console
+// colors, which is only the case when writing to stdout. Other writers get
+// plain text unless gANSI is set.
+func consoleColors() bool {
+	return gOut == io.Writer(os.Stdout)
+}
+
+// setStyle starts showing a kind of text, one of the st_* constants.
+func setStyle(kind int) {
+	if gOptions.NoColor {
+		return
+	}
+
+	st := &currentTheme()[kind]
+	if gANSI {
+		fmt.Fprint(gOut, st.ansi(colorDepth()))
+		return
+	} // if
+	if !consoleColors() {
+		return
+	} // if
+	if st.fg == ct.None && st.bg == ct.None {
+		ct.ResetColor()
+		return
+	} // if
+	ct.ChangeColor(st.fg, st.fgBright, st.bg, false)
+}
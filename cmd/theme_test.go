@@ -0,0 +1,116 @@
+package godiff
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestTextStyle_ANSI(t *testing.T) {
+	st := &themes["light"][st_DEL_TOKEN]
+	assert.StringEqual(t, "16", st.ansi(16), "\x1b[0;31m")
+	assert.StringEqual(t, "256", st.ansi(256), "\x1b[0;38;5;124;48;5;224m")
+	assert.StringEqual(t, "24-bit", st.ansi(24), "\x1b[0;38;2;175;0;0;48;2;255;215;215m")
+
+	st = &themes["mono"][st_INS_TOKEN]
+	assert.StringEqual(t, "mono", st.ansi(24), "\x1b[0;1;4m")
+	assert.Equal(t, "mono needsANSI", themes["mono"].needsANSI(16), true)
+	assert.Equal(t, "default needsANSI", themes["default"].needsANSI(16), false)
+}
+
+func TestThemes(t *testing.T) {
+	assert.StringEqual(t, "ThemeNames", ThemeNames(), []string{"colorblind", "default", "light", "mono"})
+	for name, th := range themes {
+		for kind := 0; kind < st_COUNT; kind++ {
+			if kind != st_MAT && th[kind] == (textStyle{}) {
+				t.Errorf("theme %s misses style %d", name, kind)
+			} // if
+		} // for kind
+	} // for name
+}
+
+func TestSetStyle(t *testing.T) {
+	defer func() { gOut, gOptions, gANSI = nil, Options{}, false }()
+
+	var out bytesp.Slice
+	gOut, gANSI = &out, true
+	gOptions = Options{Theme: "colorblind", Colors: 256}
+	setStyle(st_INS_TOKEN)
+	assert.StringEqual(t, "colorblind", string(out), "\x1b[0;38;5;32;48;5;23m")
+
+	out = nil
+	gOptions = Options{Theme: "colorblind", Colors: 256, NoColor: true}
+	setStyle(st_INS_TOKEN)
+	resetColor()
+	assert.StringEqual(t, "no color", string(out), "")
+}
+
+func TestColorOff(t *testing.T) {
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	defer os.Setenv("FORCE_COLOR", os.Getenv("FORCE_COLOR"))
+
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("FORCE_COLOR", "")
+	assert.Equal(t, "terminal", colorOff(false, true), false)
+	assert.Equal(t, "pipe", colorOff(false, false), true)
+	assert.Equal(t, "-no-color", colorOff(true, true), true)
+
+	os.Setenv("NO_COLOR", "1")
+	assert.Equal(t, "NO_COLOR", colorOff(false, true), true)
+
+	os.Setenv("FORCE_COLOR", "1")
+	assert.Equal(t, "FORCE_COLOR", colorOff(false, false), false)
+	assert.Equal(t, "FORCE_COLOR -no-color", colorOff(true, false), true)
+}
+
+func TestDiffSource_PlainWithColorTerm(t *testing.T) {
+	defer func() { gOptions = Options{} }()
+	defer os.Setenv("TERM", os.Getenv("TERM"))
+	defer os.Setenv("COLORTERM", os.Getenv("COLORTERM"))
+	os.Setenv("TERM", "xterm-256color")
+	os.Setenv("COLORTERM", "truecolor")
+
+	// Colors are on, but a library writer never gets ANSI sequences.
+	var buf bytesp.Slice
+	_, err := DiffSource("a.go", []byte("package main\n\nvar a = 1\n"), "b.go", []byte("package main\n\nvar a = 2\n"),
+		&buf, Options{Theme: "mono"})
+	assert.NoError(t, err)
+	assert.Equal(t, "has ANSI", strings.Contains(string(buf), "\x1b"), false)
+}
+
+func TestSetupColors(t *testing.T) {
+	defer os.Setenv("TERM", os.Getenv("TERM"))
+	defer os.Setenv("COLORTERM", os.Getenv("COLORTERM"))
+	defer os.Setenv("NO_COLOR", os.Getenv("NO_COLOR"))
+	defer os.Setenv("FORCE_COLOR", os.Getenv("FORCE_COLOR"))
+	os.Setenv("NO_COLOR", "")
+	os.Setenv("FORCE_COLOR", "")
+	os.Setenv("COLORTERM", "")
+
+	os.Setenv("TERM", "xterm")
+	options := Options{}
+	assert.Equal(t, "16 colors ansi", setupColors(&options, true), false)
+	assert.Equal(t, "16 colors", options.Colors, 16)
+
+	os.Setenv("TERM", "xterm-256color")
+	options = Options{}
+	assert.Equal(t, "256 colors ansi", setupColors(&options, true), true)
+	assert.Equal(t, "256 colors", options.Colors, 256)
+
+	options = Options{}
+	assert.Equal(t, "pipe ansi", setupColors(&options, false), false)
+	assert.Equal(t, "pipe NoColor", options.NoColor, true)
+}
+
+func TestConsoleColors(t *testing.T) {
+	defer func() { gOut = nil }()
+
+	var buf bytesp.Slice
+	gOut = &buf
+	assert.Equal(t, "buffer", consoleColors(), false)
+	gOut = os.Stdout
+	assert.Equal(t, "stdout", consoleColors(), true)
+}
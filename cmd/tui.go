@@ -0,0 +1,445 @@
+package godiff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/daviddengcn/go-colortext"
+)
+
+const ansiReset = "\x1b[0m"
+
+// ansiColor returns the ANSI sequence changing the colors.
+func ansiColor(fg ct.Color, fgBright bool, bg ct.Color, bgBright bool) string {
+	var codes []string
+	if fg != ct.None {
+		base := 30
+		if fgBright {
+			base = 90
+		} // if
+		codes = append(codes, strconv.Itoa(base+int(fg-ct.Black)))
+	} // if
+	if bg != ct.None {
+		base := 40
+		if bgBright {
+			base = 100
+		} // if
+		codes = append(codes, strconv.Itoa(base+int(bg-ct.Black)))
+	} // if
+	if len(codes) == 0 {
+		return ansiReset
+	} // if
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// visibleWidth returns the number of columns of a line with ANSI sequences.
+func visibleWidth(s string) (w int) {
+	inEsc := false
+	for _, c := range s {
+		switch {
+		case inEsc:
+			inEsc = c < '@' || c > '~' || c == '['
+		case c == '\x1b':
+			inEsc = true
+		default:
+			w = nextColumn(w, c)
+		}
+	} // for c
+	return w
+}
+
+// fitWidth truncates, or pads with spaces, a line with ANSI sequences to
+// width columns.
+func fitWidth(s string, width int) string {
+	var b strings.Builder
+	w, inEsc, full := 0, false, false
+	for _, c := range s {
+		switch {
+		case inEsc:
+			inEsc = c < '@' || c > '~' || c == '['
+			b.WriteRune(c)
+			continue
+		case c == '\x1b':
+			inEsc = true
+			b.WriteRune(c)
+			continue
+		}
+		next := nextColumn(w, c)
+		if full || next > width {
+			// the rest is cut, and a wide rune or tab not fitting is padded
+			full = true
+			continue
+		} // if
+		if c == '\t' {
+			b.WriteString(strings.Repeat(" ", next-w))
+		} else {
+			b.WriteRune(c)
+		} // else
+		w = next
+	} // for c
+	return b.String() + ansiReset + strings.Repeat(" ", width-w)
+}
+
+// tuiEntry is a changed declaration listed in the sidebar.
+type tuiEntry struct {
+	status string // "+" added, "-" deleted or "~" modified
+	title  string
+	render func()
+}
+
+// partTitle returns the title of a top level fragment, e.g. "func S.M".
+func partTitle(info *fileInfo, f diffFragment) string {
+	kind := ""
+	switch nd := f.(*fragment).node.(type) {
+	case *ast.TypeSpec:
+		kind = "type"
+	case *ast.ValueSpec:
+		kind = "var"
+	case *ast.GenDecl:
+		kind = nd.Tok.String()
+	case *ast.FuncDecl:
+		kind = "func"
+	}
+	return kind + " " + strings.Join(partSymbols(info, f), ", ")
+}
+
+// tuiEntries returns the changed declarations of types, vars and funcs.
+func tuiEntries(orgInfo, newInfo *fileInfo) (entries []tuiEntry) {
+	for _, grp := range [][2]*fragment{
+		{orgInfo.types, newInfo.types},
+		{orgInfo.vars, newInfo.vars},
+		{orgInfo.funcs, newInfo.funcs},
+	} {
+		orgParts, newParts := grp[0].Parts, grp[1].Parts
+		mat, matA, matB := matchParts(orgParts, newParts)
+		for i, j := range matA {
+			o := orgParts[i]
+			switch {
+			case j < 0 && selected(orgInfo, o):
+				entries = append(entries, tuiEntry{status: "-", title: partTitle(orgInfo, o), render: func() {
+					showDelLines(o.sourceLines(""), foldGap())
+				}})
+			case j >= 0 && mat[i][j] > 0 && selectedPair(orgInfo, o, newInfo, newParts[j]):
+				n := newParts[j]
+				entries = append(entries, tuiEntry{status: "~", title: partTitle(newInfo, n), render: func() {
+					o.showDiff(n)
+				}})
+			}
+		} // for i, j
+		for j, i := range matB {
+			if i < 0 && selected(newInfo, newParts[j]) {
+				n := newParts[j]
+				entries = append(entries, tuiEntry{status: "+", title: partTitle(newInfo, n), render: func() {
+					showInsLines(n.sourceLines(""), foldGap())
+				}})
+			} // if
+		} // for j, i
+	} // for grp
+	return entries
+}
+
+// renderEntry returns the lines of the diff of an entry with ANSI colors.
+func renderEntry(e tuiEntry, fold bool) []string {
+	defer func(out io.Writer, ansi, noFold bool) {
+		gOut, gANSI, gOptions.NoFold = out, ansi, noFold
+	}(gOut, gANSI, gOptions.NoFold)
+
+	var buf bytes.Buffer
+	gOut, gANSI, gOptions.NoFold = &buf, true, !fold
+	e.render()
+	return strings.Split(strings.TrimRight(strings.Replace(buf.String(), "\t", "    ", -1), "\n"), "\n")
+}
+
+// tui is the state of the terminal UI.
+type tui struct {
+	entries  []tuiEntry
+	sel      int
+	lines    []string // rendered lines of the selected entry
+	top      int      // first line of the diff pane
+	fold     bool
+	expanded bool // whether the diff pane takes the whole screen
+	width    int
+	height   int
+}
+
+func newTUI(entries []tuiEntry, width, height int) *tui {
+	t := &tui{entries: entries, fold: true, width: width, height: height}
+	t.selectEntry(0)
+	return t
+}
+
+func (t *tui) selectEntry(i int) {
+	if len(t.entries) == 0 {
+		return
+	} // if
+	if i < 0 {
+		i = 0
+	} // if
+	if i >= len(t.entries) {
+		i = len(t.entries) - 1
+	} // if
+	t.sel, t.top = i, 0
+	t.lines = renderEntry(t.entries[i], t.fold)
+}
+
+// paneHeight is the number of lines of the diff pane, excluding the status
+// line.
+func (t *tui) paneHeight() int {
+	if t.height < 2 {
+		return 1
+	} // if
+	return t.height - 1
+}
+
+func (t *tui) scroll(delta int) {
+	t.top += delta
+	if mx := len(t.lines) - t.paneHeight(); t.top > mx {
+		t.top = mx
+	} // if
+	if t.top < 0 {
+		t.top = 0
+	} // if
+}
+
+// isChangeLine returns true if a rendered line is a changed one.
+func isChangeLine(line string) bool {
+	for _, prefix := range []string{"---", "+++", "===", "###"} {
+		if strings.Contains(line, prefix+" ") {
+			return true
+		} // if
+	} // for prefix
+	return false
+}
+
+// jumpChange scrolls to the start of the next, or previous if dir < 0, block
+// of changed lines in the diff pane.
+func (t *tui) jumpChange(dir int) {
+	for i := t.top + dir; i >= 0 && i < len(t.lines); i += dir {
+		if isChangeLine(t.lines[i]) && (i == 0 || !isChangeLine(t.lines[i-1])) {
+			t.top = i
+			t.scroll(0)
+			return
+		} // if
+	} // for i
+}
+
+// handleKey updates the state for a key and returns false to quit.
+func (t *tui) handleKey(key string) bool {
+	switch key {
+	case "q", "ctrl-c":
+		return false
+	case "j", "down":
+		t.selectEntry(t.sel + 1)
+	case "k", "up":
+		t.selectEntry(t.sel - 1)
+	case "J", "ctrl-e":
+		t.scroll(1)
+	case "K", "ctrl-y":
+		t.scroll(-1)
+	case "pgdn", " ":
+		t.scroll(t.paneHeight())
+	case "pgup", "b":
+		t.scroll(-t.paneHeight())
+	case "n":
+		t.jumpChange(1)
+	case "N":
+		t.jumpChange(-1)
+	case "enter":
+		t.expanded = !t.expanded
+	case "f":
+		t.fold = !t.fold
+		top := t.top
+		t.selectEntry(t.sel)
+		t.scroll(top)
+	}
+	return true
+}
+
+// frame returns the lines of the screen.
+func (t *tui) frame() (lines []string) {
+	sideW := 0
+	if !t.expanded {
+		sideW = t.width * 3 / 10
+		if sideW > 40 {
+			sideW = 40
+		} // if
+	} // if
+	paneW := t.width - sideW
+	if sideW > 0 {
+		paneW--
+	} // if
+
+	h := t.paneHeight()
+	// keep the selected entry visible
+	sideTop := 0
+	if t.sel >= h {
+		sideTop = t.sel - h + 1
+	} // if
+	for i := 0; i < h; i++ {
+		line := ""
+		if sideW > 0 {
+			side := ""
+			if k := sideTop + i; k < len(t.entries) {
+				e := t.entries[k]
+				side = e.status + " " + e.title
+				if k == t.sel {
+					// highlight the whole width
+					if pad := sideW - visibleWidth(side); pad > 0 {
+						side += strings.Repeat(" ", pad)
+					} // if
+					side = "\x1b[7m" + side
+				} // if
+			} // if
+			line = fitWidth(side, sideW) + "|"
+		} // if
+		pane := ""
+		if k := t.top + i; k < len(t.lines) {
+			pane = t.lines[k]
+		} // if
+		lines = append(lines, line+fitWidth(pane, paneW))
+	} // for i
+
+	status := fmt.Sprintf("%d/%d  j/k: select  J/K: scroll  n/N: next/prev change  enter: expand  f: fold (%v)  q: quit",
+		t.sel+1, len(t.entries), t.fold)
+	return append(lines, "\x1b[7m"+fitWidth(status, t.width))
+}
+
+// stty runs stty on the terminal with the arguments and returns the output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		cmd.Stdin = tty
+	} // if
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the size of the terminal, or 80x24 if unknown.
+func terminalSize() (width, height int) {
+	width, height = 80, 24
+	if out, err := stty("size"); err == nil {
+		if fields := strings.Fields(out); len(fields) == 2 {
+			if h, err := strconv.Atoi(fields[0]); err == nil && h > 0 {
+				height = h
+			} // if
+			if w, err := strconv.Atoi(fields[1]); err == nil && w > 0 {
+				width = w
+			} // if
+		} // if
+	} // if
+	return width, height
+}
+
+// readKey reads a key press in raw mode.
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	} // if
+	switch c {
+	case 3:
+		return "ctrl-c", nil
+	case 5:
+		return "ctrl-e", nil
+	case 25:
+		return "ctrl-y", nil
+	case '\r', '\n':
+		return "enter", nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return "esc", nil
+		} // if
+		seq := []byte{}
+		for r.Buffered() > 0 {
+			b, _ := r.ReadByte()
+			seq = append(seq, b)
+			if b >= '@' && b <= '~' && b != '[' {
+				break
+			} // if
+		} // for
+		switch string(seq) {
+		case "[A":
+			return "up", nil
+		case "[B":
+			return "down", nil
+		case "[5~":
+			return "pgup", nil
+		case "[6~":
+			return "pgdn", nil
+		}
+		return "esc", nil
+	}
+	return string(rune(c)), nil
+}
+
+// ExecTUI shows the changed declarations of two Go files in a full-screen
+// terminal UI. Not thread-safe.
+func ExecTUI(orgFn, newFn string, options Options) error {
+	if err := checkStdin(orgFn, newFn); err != nil {
+		return err
+	} // if
+	setupColors(&options, true)
+	gOptions = options
+	gDiffs = 0
+	var infos [2]*fileInfo
+	for i, fn := range []string{orgFn, newFn} {
+		src, err := readSource(fn)
+		if err != nil {
+			return err
+		} // if
+		if infos[i], err = parse(fn, src); err != nil {
+			return err
+		} // if
+	} // for i, fn
+	entries := tuiEntries(infos[0], infos[1])
+	if len(entries) == 0 {
+		fmt.Println("No semantic difference.")
+		return nil
+	} // if
+
+	state, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("not a terminal: %v", err)
+	} // if
+	if _, err := stty("raw", "-echo"); err != nil {
+		return err
+	} // if
+	out := bufio.NewWriter(os.Stdout)
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l")
+		out.Flush()
+		stty(state)
+	}()
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+
+	width, height := terminalSize()
+	t := newTUI(entries, width, height)
+	in := bufio.NewReader(os.Stdin)
+	for {
+		out.WriteString("\x1b[H")
+		for i, line := range t.frame() {
+			if i > 0 {
+				out.WriteString("\r\n")
+			} // if
+			out.WriteString(line)
+		} // for i, line
+		out.Flush()
+
+		key, err := readKey(in)
+		if err != nil {
+			return err
+		} // if
+		if !t.handleKey(key) {
+			return nil
+		} // if
+	} // for
+}
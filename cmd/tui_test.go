@@ -0,0 +1,103 @@
+package godiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daviddengcn/go-colortext"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestAnsiColor(t *testing.T) {
+	assert.StringEqual(t, "red", ansiColor(ct.Red, false, ct.None, false), "\x1b[31m")
+	assert.StringEqual(t, "bright yellow", ansiColor(ct.Yellow, true, ct.None, false), "\x1b[93m")
+	assert.StringEqual(t, "on green", ansiColor(ct.None, false, ct.Green, false), "\x1b[42m")
+}
+
+func TestFitWidth(t *testing.T) {
+	assert.Equal(t, "visibleWidth", visibleWidth("\x1b[31mabc\x1b[0m"), 3)
+	assert.StringEqual(t, "truncate", fitWidth("\x1b[31mabcdef", 3), "\x1b[31mabc\x1b[0m")
+	assert.StringEqual(t, "pad", fitWidth("ab", 4), "ab\x1b[0m  ")
+	assert.Equal(t, "visibleWidth wide", visibleWidth("a中\tb"), 9)
+	assert.StringEqual(t, "wide", fitWidth("a中文", 4), "a中\x1b[0m ")
+}
+
+func TestTUI(t *testing.T) {
+	gOptions = Options{NoColor: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+type T int
+
+func a() int {
+	x := 1
+	y := 2
+	z := 3
+	w := 4
+	return x + y + z + w
+}
+
+func b() {
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+type T int64
+
+func a() int {
+	x := 1
+	y := 2
+	z := 3
+	w := 5
+	return x + y + z + w
+}
+
+func c(s string) {
+	println(s)
+}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	entries := tuiEntries(orgInfo, newInfo)
+	var titles []string
+	for _, e := range entries {
+		titles = append(titles, e.status+" "+e.title)
+	} // for e
+	assert.StringEqual(t, "titles", titles, []string{"~ type T", "~ func a", "- func b", "+ func c"})
+
+	ui := newTUI(entries, 40, 6)
+	assert.StringEqual(t, "frame", ui.frame()[0], "\x1b[7m~ type T    \x1b[0m|--- type T int\x1b[0m             ")
+
+	ui.handleKey("j")
+	assert.Equal(t, "sel", ui.sel, 1)
+	assert.StringEqual(t, "lines", ui.lines, []string{
+		"    func a() int {",
+		"        ... (2 lines)",
+		"        z := 3",
+		"---     w := 4",
+		"+++     w := 5",
+		"        return x + y + z + w",
+		"    }",
+	})
+
+	// The pane shows 5 lines, so scrolling stops at line 2.
+	ui.handleKey("n")
+	assert.Equal(t, "top", ui.top, 2)
+
+	ui.handleKey("f")
+	assert.Equal(t, "len(lines) unfolded", len(ui.lines), 8)
+	assert.StringEqual(t, "lines[1]", ui.lines[1], "        x := 1")
+
+	ui.handleKey("enter")
+	assert.Equal(t, "expanded", strings.Contains(ui.frame()[0], "|"), false)
+
+	assert.Equal(t, "quit", ui.handleKey("q"), false)
+}
@@ -0,0 +1,167 @@
+package godiff
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+)
+
+// gImporter is shared by both versions so that imported packages are loaded
+// only once. It reads the source of imported packages, so no compiled export
+// data or network is needed.
+var gImporter types.Importer
+
+// typeCheck type-checks a single file. Errors, e.g. references to declarations
+// in other files of the package, are ignored and as many types as possible are
+// resolved.
+func typeCheck(fs *token.FileSet, f *ast.File) *types.Info {
+	if gImporter == nil {
+		gImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+	} // if
+
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{
+		Importer: gImporter,
+		Error:    func(error) {},
+	}
+	conf.Check(f.Name.Name, fs, []*ast.File{f}, info)
+	return info
+}
+
+// qualifiedTypeString returns the string of t with packages identified by their
+// paths, so that types of different versions can be compared.
+func qualifiedTypeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		return p.Path()
+	})
+}
+
+// resolvedTypeString returns the string of t followed by its underlying type
+// if they are different, e.g. "time.Duration (int64)".
+func resolvedTypeString(t types.Type) string {
+	s := types.TypeString(t, func(p *types.Package) string {
+		return p.Name()
+	})
+	if u := t.Underlying(); u != t {
+		s += " (" + types.TypeString(u, func(p *types.Package) string {
+			return p.Name()
+		}) + ")"
+	} // if
+	return s
+}
+
+func showTypeNote(what string, orgT, newT types.Type) {
+	if orgT == nil || newT == nil {
+		return
+	} // if
+
+	if qualifiedTypeString(orgT) == qualifiedTypeString(newT) {
+		showNoteLine(fmt.Sprintf("%s type unchanged: %s", what, resolvedTypeString(newT)))
+		return
+	} // if
+
+	rep := "representation changed"
+	if qualifiedTypeString(orgT.Underlying()) == qualifiedTypeString(newT.Underlying()) {
+		rep = "representation identical"
+	} // if
+	showNoteLine(fmt.Sprintf("%s type changed from %s to %s: %s", what,
+		resolvedTypeString(orgT), resolvedTypeString(newT), rep))
+}
+
+func defType(info *fileInfo, name *ast.Ident) types.Type {
+	if info.typesInfo == nil {
+		return nil
+	} // if
+	obj := info.typesInfo.Defs[name]
+	if obj == nil {
+		return nil
+	} // if
+	return obj.Type()
+}
+
+// fieldTypes returns the type expressions of the fields in fl, one for each
+// name.
+func fieldTypes(fl *ast.FieldList) (tps []ast.Expr) {
+	if fl == nil {
+		return nil
+	} // if
+	for _, f := range fl.List {
+		tps = append(tps, f.Type)
+		for i := 1; i < len(f.Names); i++ {
+			tps = append(tps, f.Type)
+		} // for i
+	} // for f
+	return tps
+}
+
+// annotateTypes shows the resolved types of a changed global declaration.
+// A type is annotated if its source or its resolved type changed.
+func annotateTypes(orgInfo *fileInfo, orgF diffFragment, newInfo *fileInfo, newF diffFragment) {
+	switch on := orgF.(*fragment).node.(type) {
+	case *ast.FuncDecl:
+		nn, ok := newF.(*fragment).node.(*ast.FuncDecl)
+		if !ok {
+			return
+		} // if
+		orgSig, _ := defType(orgInfo, on.Name).(*types.Signature)
+		newSig, _ := defType(newInfo, nn.Name).(*types.Signature)
+		if orgSig == nil || newSig == nil {
+			return
+		} // if
+		annotateTuples("parameter", fieldTypes(on.Type.Params), orgSig.Params(), fieldTypes(nn.Type.Params), newSig.Params())
+		annotateTuples("result", fieldTypes(on.Type.Results), orgSig.Results(), fieldTypes(nn.Type.Results), newSig.Results())
+
+	case *ast.ValueSpec:
+		nn, ok := newF.(*fragment).node.(*ast.ValueSpec)
+		if !ok || len(on.Names) != len(nn.Names) {
+			return
+		} // if
+		srcChanged := (on.Type == nil) != (nn.Type == nil) ||
+			on.Type != nil && exprString(on.Type) != exprString(nn.Type)
+		for i := range on.Names {
+			orgT, newT := defType(orgInfo, on.Names[i]), defType(newInfo, nn.Names[i])
+			if orgT == nil || newT == nil {
+				continue
+			} // if
+			if srcChanged || qualifiedTypeString(orgT) != qualifiedTypeString(newT) {
+				showTypeNote("var "+nn.Names[i].Name, orgT, newT)
+			} // if
+		} // for i
+
+	case *ast.TypeSpec:
+		nn, ok := newF.(*fragment).node.(*ast.TypeSpec)
+		if !ok {
+			return
+		} // if
+		orgT, newT := defType(orgInfo, on.Name), defType(newInfo, nn.Name)
+		if orgT == nil || newT == nil {
+			return
+		} // if
+		switch newT.Underlying().(type) {
+		case *types.Struct, *types.Interface:
+			// fields and methods are compared in details already
+			return
+		}
+		showTypeNote("type "+nn.Name.Name+" underlying", orgT.Underlying(), newT.Underlying())
+	}
+}
+
+func annotateTuples(kind string, orgSrc []ast.Expr, orgT *types.Tuple, newSrc []ast.Expr, newT *types.Tuple) {
+	if orgT.Len() != newT.Len() || len(orgSrc) != orgT.Len() || len(newSrc) != newT.Len() {
+		return
+	} // if
+	for i := 0; i < orgT.Len(); i++ {
+		ov, nv := orgT.At(i), newT.At(i)
+		if exprString(orgSrc[i]) == exprString(newSrc[i]) &&
+			qualifiedTypeString(ov.Type()) == qualifiedTypeString(nv.Type()) {
+			continue
+		} // if
+		what := kind
+		if nv.Name() != "" {
+			what += " " + nv.Name()
+		} // if
+		showTypeNote(what, ov.Type(), nv.Type())
+	} // for i
+}
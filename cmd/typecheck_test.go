@@ -0,0 +1,55 @@
+package godiff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golangplus/bytes"
+	"github.com/golangplus/testing/assert"
+)
+
+func TestDiff_TypeCheck(t *testing.T) {
+	var buf bytesp.Slice
+	gOut = &buf
+	gOptions = Options{TypeCheck: true}
+	defer func() { gOptions = Options{} }()
+
+	orgInfo, err := parse("", `
+package main
+
+import t "time"
+
+type ID int
+
+func Sleep(d t.Duration, id ID) {}
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	newInfo, err := parse("", `
+package main
+
+import tm "time"
+
+type ID int32
+
+func Sleep(d int64, id ID) tm.Duration { return 0 }
+	`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	diffTypes(orgInfo, newInfo)
+	diffFuncs(orgInfo, newInfo)
+
+	var notes []string
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.HasPrefix(line, ":::") {
+			notes = append(notes, line)
+		}
+	}
+	assert.StringEqual(t, "notes", notes, []string{
+		"::: type ID underlying type changed from int to int32: representation changed",
+		"::: parameter d type changed from time.Duration (int64) to int64: representation identical",
+	})
+}
@@ -13,25 +13,186 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/daviddengcn/go-diff/cmd"
 	"github.com/golangplus/fmt"
 )
 
 func usage() {
-	fmtp.Eprintfln("usage: go-diff [options] org-filename new-filename")
+	fmtp.Eprintfln("usage: go-diff [options] org-filename new-filename (- for stdin)")
+	fmtp.Eprintfln("       go-diff merge base-filename ours-filename theirs-filename")
+	fmtp.Eprintfln("       go-diff diff3 base-filename ours-filename theirs-filename")
+	fmtp.Eprintfln("       go-diff apply patch-filename filename")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
 
+func validTheme(name string) bool {
+	for _, n := range godiff.ThemeNames() {
+		if n == name {
+			return true
+		} // if
+	} // for n
+	return false
+}
+
+// configKeys are the flags a config file may set.
+var configKeys = []string{
+	"no-color", "normalize", "order", "fold-consts", "types", "api", "callers", "callgraph", "metrics", "errors",
+	"concurrency", "ignore-generated", "ignore-tests", "ignore-unexported", "ignore", "only", "strict", "partial",
+	"no-pager", "width", "wrap", "U", "fold-added", "no-fold", "full", "theme", "colors",
+}
+
 func main() {
 	var options godiff.Options
 
 	flag.BoolVar(&options.NoColor, "no-color", false, "turn off the colors")
+	flag.BoolVar(&options.Normalize, "normalize", false, "ignore commutative and trivial expression changes")
+	flag.BoolVar(&options.Ordered, "order", false, "report reordered global declarations as moved")
+	flag.BoolVar(&options.FoldConsts, "fold-consts", false, "compare evaluated values of constant expressions")
+	flag.BoolVar(&options.TypeCheck, "types", false, "type-check both files and annotate changes with resolved types")
+	flag.BoolVar(&options.API, "api", false, "report exported API changes and the suggested semver bump")
+	flag.BoolVar(&options.Symbols, "symbols", false, "print only the qualified names of changed declarations")
+	flag.BoolVar(&options.SymbolCallers, "callers", false, "with -symbols, also print the functions referencing changed declarations")
+	flag.BoolVar(&options.CallGraph, "callgraph", false, "annotate changed functions with their callers and changed calls")
+	flag.BoolVar(&options.Metrics, "metrics", false, "annotate changed functions with complexity and size metrics")
+	flag.BoolVar(&options.Stat, "stat", false, "print only a summary of changed declarations and complexity increases")
+	flag.BoolVar(&options.ErrCheck, "errors", false, "warn about changed error handling in functions")
+	flag.BoolVar(&options.Concurrency, "concurrency", false, "highlight changes touching goroutines, channels, locks and sync")
+	flag.BoolVar(&options.IgnoreGenerated, "ignore-generated", false, "ignore generated files")
+	flag.BoolVar(&options.IgnoreTests, "ignore-tests", false, "ignore _test.go files")
+	flag.BoolVar(&options.IgnoreUnexported, "ignore-unexported", false, "ignore unexported declarations")
+	ignoreNames := flag.String("ignore", "", "comma-separated name patterns of declarations to ignore, e.g. String,*_gen")
+	only := flag.String("only", "", "comma-separated name patterns of the only declarations to show, e.g. Server.*,New*")
+	flag.StringVar(only, "symbol", "", "alias of -only")
+	flag.BoolVar(&options.Strict, "strict", false, "fail instead of falling back to the line diff when parsing fails")
+	flag.BoolVar(&options.Partial, "partial", false, "on parse errors, diff the declarations that parsed instead of falling back to the line diff")
+	textconv := flag.Bool("textconv", false, "print a canonical form of a Go file, for git's textconv")
+	patch := flag.Bool("patch", false, "print the semantic patch between the files in JSON, for go-diff apply")
+	tui := flag.Bool("tui", false, "browse the changed declarations in a full-screen terminal UI")
+	flag.BoolVar(&options.NoPager, "no-pager", false, "do not page the output through $PAGER")
+	flag.IntVar(&options.Width, "width", 0, "truncate lines longer than the width, marked with \"…\", 0 for no limit")
+	flag.BoolVar(&options.Wrap, "wrap", false, "soft-wrap long lines at -width, or the terminal width")
+	flag.IntVar(&options.Context, "U", 1, "number of unchanged lines shown around changes")
+	flag.IntVar(&options.FoldAdded, "fold-added", 2, "number of lines shown at each end of added or deleted declarations before folding")
+	flag.BoolVar(&options.NoFold, "no-fold", false, "show all unchanged lines and added or deleted declarations without folding")
+	flag.BoolVar(&options.FullText, "full", false, "show the full text of added or deleted types and functions instead of one line")
+	flag.StringVar(&options.Theme, "theme", "default", "color theme: "+strings.Join(godiff.ThemeNames(), ", "))
+	flag.IntVar(&options.Colors, "colors", 0, "number of colors: 16, 256 or 24 for 24-bit, 0 to detect from $COLORTERM and $TERM")
+	printConfig := flag.Bool("print-config", false, "print the effective settings in the config file format and exit")
 
 	flag.Usage = usage
 	flag.Parse()
 
+	// The config files are searched from the first file, and do not override
+	// the flags on the command line.
+	dir := godiff.ConfigDir(flag.Args())
+	if dir == "" {
+		dir, _ = os.Getwd()
+	} // if
+	if err := godiff.ApplyConfigs(flag.CommandLine, godiff.FindConfigs(dir), configKeys...); err != nil {
+		fmtp.Eprintfln("go-diff: %v", err)
+		os.Exit(2)
+	} // if
+
+	if *printConfig {
+		godiff.PrintConfig(os.Stdout, flag.CommandLine, configKeys...)
+		return
+	} // if
+
+	// 0 in Options means the default, while -U 0 and -fold-added 0 mean none.
+	if options.Context == 0 {
+		options.Context = -1
+	} // if
+	if options.FoldAdded == 0 {
+		options.FoldAdded = -1
+	} // if
+	if !validTheme(options.Theme) {
+		fmtp.Eprintfln("go-diff: unknown theme %q, want one of %s", options.Theme, strings.Join(godiff.ThemeNames(), ", "))
+		os.Exit(2)
+	} // if
+	switch options.Colors {
+	case 0, 16, 256, 24:
+	default:
+		fmtp.Eprintfln("go-diff: invalid -colors %d, want 16, 256 or 24", options.Colors)
+		os.Exit(2)
+	} // switch
+
+	if *ignoreNames != "" {
+		options.IgnoreNames = strings.Split(*ignoreNames, ",")
+	} // if
+	if *only != "" {
+		options.Only = strings.Split(*only, ",")
+	} // if
+
+	if *textconv && flag.NArg() == 1 {
+		if err := godiff.Textconv(os.Stdout, flag.Arg(0)); err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		return
+	} // if
+	if flag.NArg() == 3 && flag.Arg(0) == "apply" {
+		if err := godiff.ExecApply(flag.Arg(1), flag.Arg(2)); err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		return
+	} // if
+	if *tui && flag.NArg() == 2 {
+		if err := godiff.ExecTUI(flag.Arg(0), flag.Arg(1), options); err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		return
+	} // if
+	if *patch && flag.NArg() == 2 {
+		if err := godiff.ExecPatch(flag.Arg(0), flag.Arg(1), os.Stdout); err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		return
+	} // if
+	args := flag.Args()
+	if len(args) == 4 && args[0] == "diff3" {
+		args = args[1:]
+	} else if filepath.Base(os.Args[0]) != "go-diff3" {
+		args = nil
+	} // else if
+	if len(args) == 3 {
+		differ, err := godiff.ExecDiff3(args[0], args[1], args[2], os.Stdout, options)
+		if err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		if differ {
+			os.Exit(1)
+		} // if
+		return
+	} // if
+	if flag.NArg() == 4 && flag.Arg(0) == "merge" {
+		conflicts, err := godiff.ExecMerge(flag.Arg(1), flag.Arg(2), flag.Arg(3))
+		if err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		if conflicts > 0 {
+			fmtp.Eprintfln("go-diff: %d conflicts in %s", conflicts, flag.Arg(2))
+			os.Exit(1)
+		} // if
+		return
+	} // if
+	if godiff.IsGitArgs(flag.Args()) || flag.NArg() == 1 && os.Getenv("GIT_DIFF_PATH_TOTAL") != "" {
+		// Called as GIT_EXTERNAL_DIFF, git aborts on a non-zero exit status
+		// so differences are not reported in it.
+		if _, err := godiff.ExecGit(flag.Args(), os.Stdout, options); err != nil {
+			fmtp.Eprintfln("go-diff: %v", err)
+			os.Exit(2)
+		} // if
+		return
+	} // if
 	if flag.NArg() < 2 {
 		usage()
 		return
@@ -39,5 +200,12 @@ func main() {
 	orgFn := flag.Arg(0)
 	newFn := flag.Arg(1)
 
-	godiff.Exec(orgFn, newFn, options)
+	differ, err := godiff.Exec(orgFn, newFn, options)
+	if err != nil {
+		fmtp.Eprintfln("go-diff: %v", err)
+		os.Exit(2)
+	} // if
+	if differ {
+		os.Exit(1)
+	} // if
 }
@@ -3,8 +3,8 @@
 
 import godiff "github.com/daviddengcn/go-diff/cmd"
 
-if len(Args) < 7 {
+if !godiff.IsGitArgs(Args[1:]) && len(Args) != 2 {
 	Fatalf("go-diff.gs is supposed to be called from Git")
 }
 
-godiff.Exec(Args[2], Args[5], godiff.Options{})
+godiff.ExecGit(Args[1:], os.Stdout, godiff.Options{})
@@ -1,3 +1,4 @@
 #!/bin/bash
 
-go-diff $2 $5
\ No newline at end of file
+# go-diff speaks git's GIT_EXTERNAL_DIFF protocol itself.
+exec go-diff "$@"